@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/thehypercloud/apiclient-go"
+)
+
+// Client wraps the HyperCloud apiclient, optionally retrying calls that
+// fail with a transient error.
+type Client struct {
+	*hypercloud.ApiClient
+
+	// Retry controls retries of failed calls. The zero value disables them.
+	Retry RetryPolicy
+
+	// Context cancels any backoff between retries. Defaults to Background.
+	Context context.Context
+
+	// OnRetry, if set, is called before each retry, e.g. to report it in
+	// the Packer UI.
+	OnRetry func(err error, attempt int, wait time.Duration)
+}
+
+// RetryPolicy controls how many times and for how long a failed call to
+// the API is retried.
+type RetryPolicy struct {
+	MaxRetries int           // retries after the first attempt, zero disables retrying
+	Timeout    time.Duration // total time allowed to retry a single call, zero for no limit
+}
+
+// apiPath is the path of the API below a HyperCloud's URL, as used by the
+// apiclient, for requests it has no call for
+const apiPath = "/api/v1"
+
+const (
+	retryInitialWait = 1 * time.Second
+	retryMaxWait     = 30 * time.Second
+)
+
+// Endpoint is the URL of a HyperCloud and the credentials used with it:
+// either an access token, or an application's id and secret
+type Endpoint struct {
+	URL         string
+	ID          string
+	Secret      string
+	AccessToken string
+}
+
+func NewClient(client *hypercloud.ApiClient) *Client {
+	return &Client{ApiClient: client}
+}
+
+// Connect returns a client for the HyperCloud at endpoint, authenticating
+// with its access token if it has one, otherwise its id and secret
+func Connect(endpoint Endpoint) *Client {
+	var raw hypercloud.ApiClient
+	if endpoint.AccessToken == "" {
+		raw = hypercloud.NewApplicationClient(endpoint.URL, endpoint.ID, endpoint.Secret)
+	} else {
+		raw = hypercloud.NewAccessTokenClient(endpoint.URL, endpoint.AccessToken)
+	}
+	return NewClient(&raw)
+}
+
+// WithContext returns a copy of the client whose retries are cancelled by
+// ctx instead, e.g. so that cleanup can still retry after a build has been
+// cancelled.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	copied := *c
+	copied.Context = ctx
+	return &copied
+}
+
+// retryMode describes when it is safe to send a failed request again
+type retryMode int
+
+const (
+	// Reads, and updates that replace state wholesale. Any retryable error
+	// is retried.
+	idempotent retryMode = iota
+	// Deletes are retried like idempotent calls, and a 404 on a retry is
+	// taken to mean an earlier attempt succeeded.
+	deleting
+	// Creates and actions, which are only retried when the request is
+	// known not to have been acted on.
+	mutating
+)
+
+type call func() (int, map[string]interface{}, error)
+type listCall func() (int, []map[string]interface{}, error)
+
+// request sends an apiclient call, retrying it according to the client's
+// policy, and converts a failure into an *Error.
+func (c *Client) request(mode retryMode, op string, kind string, id string, fn call) (map[string]interface{}, error) {
+	var body map[string]interface{}
+	err := c.retry(mode, func() error {
+		status, result, err := fn()
+		body = result
+		return checkResponse(op, kind, id, status, result, err)
+	})
+	return body, err
+}
+
+// requestList is request for calls returning a list, which are all reads
+func (c *Client) requestList(op string, kind string, fn listCall) ([]map[string]interface{}, error) {
+	return c.requestArray(idempotent, op, kind, "", fn)
+}
+
+// requestArray is request for calls returning an array, such as the
+// updates of an instance's disks, public keys and network adapters, which
+// return the instance's new set of them
+func (c *Client) requestArray(mode retryMode, op string, kind string, id string, fn listCall) ([]map[string]interface{}, error) {
+	var body []map[string]interface{}
+	err := c.retry(mode, func() error {
+		status, result, err := fn()
+		body = result
+		return checkResponse(op, kind, id, status, result, err)
+	})
+	return body, err
+}
+
+func (c *Client) retry(mode retryMode, attempt func() error) error {
+	ctx := c.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	started := time.Now()
+	wait := retryInitialWait
+
+	for retries := 0; ; retries++ {
+		err := attempt()
+		if err == nil {
+			return nil
+		}
+		if retries > 0 && mode == deleting && IsNotFound(err) {
+			return nil
+		}
+		if retries >= c.Retry.MaxRetries || !shouldRetry(mode, err) {
+			return err
+		}
+		if c.Retry.Timeout > 0 && time.Since(started)+wait > c.Retry.Timeout {
+			return err
+		}
+
+		if c.OnRetry != nil {
+			c.OnRetry(err, retries+1, wait)
+		}
+		if Sleep(ctx, wait) != nil {
+			return err
+		}
+		wait *= 2
+		if wait > retryMaxWait {
+			wait = retryMaxWait
+		}
+	}
+}
+
+func shouldRetry(mode retryMode, err error) bool {
+	if mode != mutating {
+		return IsRetryable(err)
+	}
+	var e *Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		// Rejected before being processed
+		return true
+	case 0:
+		return isDialError(e.Err)
+	}
+	return false
+}
+
+// isDialError reports whether err means a connection was never made, so
+// the request cannot have reached the API.
+func isDialError(err error) bool {
+	switch e := err.(type) {
+	case *url.Error:
+		return isDialError(e.Err)
+	case *net.OpError:
+		return e.Op == "dial"
+	case nil:
+		return false
+	}
+	return strings.Contains(err.Error(), "connection refused")
+}
@@ -0,0 +1,130 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thehypercloud/packer-hypercloud/api"
+	"github.com/thehypercloud/packer-hypercloud/api/hypercloudtest"
+)
+
+// countRequests returns how many requests to the server start with prefix,
+// e.g. "POST /api/v1/disks"
+func countRequests(srv *hypercloudtest.Server, prefix string) int {
+	n := 0
+	for _, r := range srv.Requests() {
+		if strings.HasPrefix(r, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestRetryReadsUntilSuccess(t *testing.T) {
+	srv := hypercloudtest.NewServer()
+	defer srv.Close()
+	srv.Seed()
+	srv.Fail("GET", "disks", http.StatusServiceUnavailable, 1)
+
+	client := srv.Client()
+	client.Retry = api.RetryPolicy{MaxRetries: 2}
+	var retried []int
+	client.OnRetry = func(err error, attempt int, wait time.Duration) {
+		retried = append(retried, attempt)
+	}
+
+	disks, err := api.DiskList(client)
+	if err != nil {
+		t.Fatalf("DiskList: %s", err)
+	}
+	if len(disks) != 1 {
+		t.Errorf("got %d disks, expected the downloader's", len(disks))
+	}
+	if len(retried) != 1 || retried[0] != 1 {
+		t.Errorf("OnRetry called for attempts %v, expected [1]", retried)
+	}
+	if n := countRequests(srv, "GET /api/v1/disks"); n != 2 {
+		t.Errorf("sent %d requests, expected 2", n)
+	}
+}
+
+func TestRetryDisabledByDefault(t *testing.T) {
+	srv := hypercloudtest.NewServer()
+	defer srv.Close()
+	srv.Fail("GET", "disks", http.StatusServiceUnavailable, 1)
+
+	_, err := api.DiskList(srv.Client())
+	if !api.IsRetryable(err) {
+		t.Fatalf("DiskList error %v, expected the injected 503", err)
+	}
+	if n := countRequests(srv, "GET /api/v1/disks"); n != 1 {
+		t.Errorf("sent %d requests, expected 1", n)
+	}
+}
+
+func TestRetryGivesUpAfterMaxRetries(t *testing.T) {
+	srv := hypercloudtest.NewServer()
+	defer srv.Close()
+	srv.Fail("GET", "disks", http.StatusBadGateway, 5)
+
+	client := srv.Client()
+	client.Retry = api.RetryPolicy{MaxRetries: 1}
+	if _, err := api.DiskList(client); err == nil {
+		t.Fatal("DiskList succeeded, expected the injected 502")
+	}
+	if n := countRequests(srv, "GET /api/v1/disks"); n != 2 {
+		t.Errorf("sent %d requests, expected 2", n)
+	}
+}
+
+func TestRetryMutatingOnlyWhenNotActedOn(t *testing.T) {
+	for _, tc := range []struct {
+		status   int
+		attempts int
+	}{
+		// Rejected before being processed, so safe to send again
+		{http.StatusServiceUnavailable, 2},
+		{http.StatusTooManyRequests, 2},
+		// May have created the disk, so not retried
+		{http.StatusBadGateway, 1},
+		{http.StatusGatewayTimeout, 1},
+	} {
+		srv := hypercloudtest.NewServer()
+		f := srv.Seed()
+		srv.Fail("POST", "disks", tc.status, 1)
+
+		client := srv.Client()
+		client.Retry = api.RetryPolicy{MaxRetries: 3}
+		_, err := api.CreateBlankDisk(context.Background(), client, 10, "disk", f.RegionID, f.DiskTierID, nil)
+		if tc.attempts == 1 && err == nil {
+			t.Errorf("%d: CreateBlankDisk succeeded, expected the injected error", tc.status)
+		}
+		if tc.attempts > 1 && err != nil {
+			t.Errorf("%d: CreateBlankDisk: %s", tc.status, err)
+		}
+		if n := countRequests(srv, "POST /api/v1/disks"); n != tc.attempts {
+			t.Errorf("%d: sent %d requests, expected %d", tc.status, n, tc.attempts)
+		}
+		srv.Close()
+	}
+}
+
+func TestRetryDeleteTakesNotFoundAsDone(t *testing.T) {
+	srv := hypercloudtest.NewServer()
+	defer srv.Close()
+	srv.Fail("DELETE", "disks/disk-9999", http.StatusServiceUnavailable, 1)
+
+	client := srv.Client()
+	client.Retry = api.RetryPolicy{MaxRetries: 2}
+	if err := api.DiskDelete(client, "disk-9999"); err != nil {
+		t.Errorf("DiskDelete: %s, expected the 404 on retry to count as deleted", err)
+	}
+
+	// Without a retry, a 404 is still an error
+	if err := api.DiskDelete(srv.Client(), "disk-9999"); !api.IsNotFound(err) {
+		t.Errorf("DiskDelete error %v, expected a 404", err)
+	}
+}
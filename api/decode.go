@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// model is implemented by every typed resource in this package, so that a
+// response missing a field the plugin relies on is reported as an error
+// instead of surfacing later as a nil dereference or bad type assertion.
+type model interface {
+	validate() error
+}
+
+// decode converts a raw response body from the apiclient into a typed
+// model and validates it.
+func decode(kind string, raw interface{}, out model) error {
+	if raw == nil {
+		return fmt.Errorf("empty %s response from api", kind)
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("error encoding %s response: %w", kind, err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("error decoding %s response: %w", kind, err)
+	}
+	return out.validate()
+}
+
+// requireFields takes name/value pairs and returns an error naming the
+// first field whose value is empty.
+func requireFields(kind string, pairs ...string) error {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] == "" {
+			return fmt.Errorf("%s in api response is missing required field %q", kind, pairs[i])
+		}
+	}
+	return nil
+}
+
+// Timestamp is a time in an api response. It is left as the zero time if
+// the field is missing or in a format that isn't recognised, rather than
+// failing to decode the whole resource.
+type Timestamp struct {
+	time.Time
+}
+
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02T15:04:05",
+}
+
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil || raw == "" {
+		return nil
+	}
+	for _, layout := range timestampLayouts {
+		if parsed, err := time.Parse(layout, raw); err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+	return nil
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.Time)
+}
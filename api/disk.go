@@ -1,100 +1,153 @@
 package api
 
 import (
-	"errors"
+	"context"
 	"fmt"
-	"time"
-
-	"github.com/thehypercloud/apiclient-go"
 )
 
 var DEFAULT_TIMEOUT uint = 180
 
-func DiskInfo(api *hypercloud.ApiClient, diskid string) (disk map[string]interface{}, err error) {
-	status, disk, error := api.Disk.Show(diskid)
+// Timeout in seconds for a newly created disk to become ready. Cloning a
+// large template can take much longer than other operations.
+var DISK_TIMEOUT uint = 1800
+
+type Disk struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	State       string    `json:"state"`
+	Size        uint      `json:"size"`
+	Cdrom       bool      `json:"cdrom"`
+	Position    int       `json:"position"`
+	InstanceID  string    `json:"instance_id"`
+	Region      Region    `json:"region"`
+	Tags        Tags      `json:"tags"`
+	CreatedAt   Timestamp `json:"created_at"`
+}
+
+func (d *Disk) validate() error {
+	return requireFields("disk", "id", d.ID, "state", d.State)
+}
+
+func DiskInfo(api *Client, diskid string) (disk *Disk, err error) {
 	if diskid == "" {
 		return nil, fmt.Errorf("diskid cannot be blank for disk info")
 	}
-	if error != nil {
-		return nil, error
+	raw, err := api.request(idempotent, "show", "disk", diskid, func() (int, map[string]interface{}, error) {
+		return api.Disk.Show(diskid)
+	})
+	if err != nil {
+		return nil, err
 	}
-	if status < 200 || status >= 300 {
-		return disk, errors.New(fmt.Sprint(status))
+	disk = new(Disk)
+	if err := decode("disk", raw, disk); err != nil {
+		return nil, err
 	}
 	return disk, nil
 }
 
-func DiskList(api *hypercloud.ApiClient) (disk []map[string]interface{}, err error) {
-	status, disks, error := api.Disk.List()
-	if error != nil {
-		return nil, error
+func DiskList(api *Client) (disks []Disk, err error) {
+	raw, err := api.requestList("list", "disks", func() (int, []map[string]interface{}, error) {
+		return api.Disk.List()
+	})
+	if err != nil {
+		return nil, err
 	}
-	if status < 200 || status >= 300 {
-		return nil, errors.New(fmt.Sprint(disks))
+	disks = make([]Disk, len(raw))
+	for i := range raw {
+		if err := decode("disk", raw[i], &disks[i]); err != nil {
+			return nil, err
+		}
 	}
 	return disks, nil
 }
 
-func UpdateDisk(api *hypercloud.ApiClient, diskid string, params map[string]interface{}) (disk map[string]interface{}, err error) {
-	status, disk, err := api.Disk.Update(diskid, params)
+func UpdateDisk(api *Client, diskid string, params map[string]interface{}) (disk *Disk, err error) {
+	raw, err := api.request(idempotent, "update", "disk", diskid, func() (int, map[string]interface{}, error) {
+		return api.Disk.Update(diskid, params)
+	})
 	if err != nil {
 		return nil, err
 	}
-	if status < 200 || status >= 300 {
-		return disk, errors.New(fmt.Sprintf("%d", status))
+	disk = new(Disk)
+	if err := decode("disk", raw, disk); err != nil {
+		return nil, err
 	}
 	return disk, nil
 }
 
-func CreateDisk(api *hypercloud.ApiClient, data map[string]interface{}) (disk map[string]interface{}, err error)  {
-	status, disk, error := api.Disk.Create(data)
+// CreateDisk creates a disk and waits for it to be ready. If the disk was
+// created but never became ready, it is returned along with the error so
+// that the caller can delete it.
+func CreateDisk(ctx context.Context, api *Client, data map[string]interface{}) (disk *Disk, err error) {
+	return createDisk(ctx, api, "create", "", func() (int, map[string]interface{}, error) {
+		return api.Disk.Create(data)
+	})
+}
 
-	if error != nil {
-		return nil, error
+// createDisk sends a call creating a disk, which op copies from source if
+// it isn't empty, and waits for the new disk to be ready
+func createDisk(ctx context.Context, api *Client, op string, source string, fn call) (disk *Disk, err error) {
+	raw, err := api.request(mutating, op, "disk", source, fn)
+	if err != nil {
+		return nil, err
 	}
-	if status < 200 || status >= 300 {
-		return disk, errors.New(fmt.Sprintf("%d: %s", status, disk))
+	disk = new(Disk)
+	if err := decode("disk", raw, disk); err != nil {
+		return nil, err
 	}
 
-	for { //ever
-		disk, err = DiskInfo(api, disk["id"].(string))
+	id := disk.ID
+	what := fmt.Sprintf("disk %s to be ready", id)
+	err = WaitFor(ctx, pollOptions(seconds(DISK_TIMEOUT)), what, func() (bool, error) {
+		latest, err := DiskInfo(api, id)
 		if err != nil {
-			return nil, err
-		} else if disk["state"] == "unattached" {
-			return disk, nil
+			return false, err
 		}
-		time.Sleep(2)
+		disk = latest
+		return disk.State == "unattached", nil
+	})
+	if err != nil {
+		return disk, err
 	}
-
 	return disk, nil
 }
 
-func CreateBlankDisk(api *hypercloud.ApiClient, size uint, name string, region string, tier string) (disk map[string]interface{}, err error) {
-	return CreateDisk(api, map[string]interface{}{
+func CreateBlankDisk(ctx context.Context, api *Client, size uint, name string, region string, tier string, tags Tags) (disk *Disk, err error) {
+	return CreateDisk(ctx, api, tags.addTo(map[string]interface{}{
 		"name":             name,
 		"size":             size,
 		"region":           region,
 		"performance_tier": tier,
-	})
+	}))
 }
 
-func CreateTemplateDisk(api *hypercloud.ApiClient, size uint, name string, region string, tier string, template string) (disk map[string]interface{}, err error) {
-	return CreateDisk(api, map[string]interface{}{
+func CreateTemplateDisk(ctx context.Context, api *Client, size uint, name string, region string, tier string, template string, tags Tags) (disk *Disk, err error) {
+	return CreateDisk(ctx, api, tags.addTo(map[string]interface{}{
 		"name":             name,
 		"size":             size,
 		"region":           region,
 		"performance_tier": tier,
 		"template":         template,
+	}))
+}
+
+// CopyDisk clones an unattached disk into a disk in the given region and
+// tier, which may be in another region, of the same size as the source
+func CopyDisk(ctx context.Context, api *Client, source string, name string, region string, tier string, tags Tags) (disk *Disk, err error) {
+	data := tags.addTo(map[string]interface{}{
+		"name":             name,
+		"region":           region,
+		"performance_tier": tier,
+	})
+	return createDisk(ctx, api, "clone", source, func() (int, map[string]interface{}, error) {
+		return api.Disk.Clone(source, data)
 	})
 }
 
-func DiskDelete(api *hypercloud.ApiClient, diskid string) (err error) {
-	status, disk, err := api.Disk.Delete(diskid)
-	if err != nil {
-		return err
-	}
-	if status < 200 || status >= 300 {
-		return errors.New(fmt.Sprintf("Error deleting disk: %d: %s", status, disk))
-	}
-	return nil
+func DiskDelete(api *Client, diskid string) (err error) {
+	_, err = api.request(deleting, "delete", "disk", diskid, func() (int, map[string]interface{}, error) {
+		return api.Disk.Delete(diskid)
+	})
+	return err
 }
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error is returned by the functions in this package when a request to
+// the HyperCloud API fails, either because it could not be sent or
+// because the response had a non-2xx status.
+type Error struct {
+	Op         string      // operation attempted, e.g. "create" or "delete"
+	Kind       string      // kind of resource, e.g. "disk" or "instance"
+	ID         string      // id of the resource, if known
+	StatusCode int         // HTTP status, 0 if no response was received
+	Body       interface{} // decoded response body, if any
+	Err        error       // transport error, if no response was received
+}
+
+func (e *Error) Error() string {
+	target := e.Kind
+	if e.ID != "" {
+		target += " " + e.ID
+	}
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%s %s failed: %s", e.Op, target, e.Err)
+	}
+	msg := http.StatusText(e.StatusCode)
+	if detail := e.message(); detail != "" {
+		msg += ": " + detail
+	}
+	return fmt.Sprintf("%s %s failed: %d %s", e.Op, target, e.StatusCode, msg)
+}
+
+// message extracts a human readable message from the error body
+func (e *Error) message() string {
+	body, ok := e.Body.(map[string]interface{})
+	if !ok {
+		if e.Body == nil {
+			return ""
+		}
+		return fmt.Sprint(e.Body)
+	}
+	for _, key := range []string{"message", "error", "errors"} {
+		if value, ok := body[key]; ok && value != nil {
+			return fmt.Sprint(value)
+		}
+	}
+	if len(body) == 0 {
+		return ""
+	}
+	return fmt.Sprint(body)
+}
+
+// checkResponse converts the result of an apiclient call into an *Error,
+// or nil if the call succeeded.
+func checkResponse(op string, kind string, id string, status int, body interface{}, err error) error {
+	if err != nil {
+		return &Error{Op: op, Kind: kind, ID: id, Err: err}
+	}
+	if status < 200 || status >= 300 {
+		return &Error{Op: op, Kind: kind, ID: id, StatusCode: status, Body: body}
+	}
+	return nil
+}
+
+// statusCode returns the status of the *Error in err's chain, or 0 if
+// there is none or no response was received
+func statusCode(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound reports whether err is an API 404 response
+func IsNotFound(err error) bool {
+	return statusCode(err) == http.StatusNotFound
+}
+
+// IsConflict reports whether err is an API 409 response
+func IsConflict(err error) bool {
+	return statusCode(err) == http.StatusConflict
+}
+
+// IsRetryable reports whether err is a transport failure or a response
+// status indicating the request may succeed if sent again.
+func IsRetryable(err error) bool {
+	var e *Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch e.StatusCode {
+	case 0:
+		return e.Err != nil
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
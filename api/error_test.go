@@ -0,0 +1,83 @@
+package api_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/thehypercloud/packer-hypercloud/api"
+	"github.com/thehypercloud/packer-hypercloud/api/hypercloudtest"
+)
+
+func TestErrorClassification(t *testing.T) {
+	dial := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	for _, tc := range []struct {
+		name      string
+		err       error
+		notFound  bool
+		conflict  bool
+		retryable bool
+	}{
+		{"nil", nil, false, false, false},
+		{"plain error", errors.New("boom"), false, false, false},
+		{"404", &api.Error{StatusCode: http.StatusNotFound}, true, false, false},
+		{"409", &api.Error{StatusCode: http.StatusConflict}, false, true, false},
+		{"422", &api.Error{StatusCode: http.StatusUnprocessableEntity}, false, false, false},
+		{"500", &api.Error{StatusCode: http.StatusInternalServerError}, false, false, false},
+		{"408", &api.Error{StatusCode: http.StatusRequestTimeout}, false, false, true},
+		{"429", &api.Error{StatusCode: http.StatusTooManyRequests}, false, false, true},
+		{"502", &api.Error{StatusCode: http.StatusBadGateway}, false, false, true},
+		{"503", &api.Error{StatusCode: http.StatusServiceUnavailable}, false, false, true},
+		{"504", &api.Error{StatusCode: http.StatusGatewayTimeout}, false, false, true},
+		{"transport", &api.Error{Err: dial}, false, false, true},
+		{"no status or error", &api.Error{}, false, false, false},
+		// Classified through the wrapping of the helpers
+		{"wrapped 404", fmt.Errorf("Error detaching disk: %w", &api.Error{StatusCode: http.StatusNotFound}), true, false, false},
+		{"wrapped 503", fmt.Errorf("Error listing disks: %w", &api.Error{StatusCode: http.StatusServiceUnavailable}), false, false, true},
+	} {
+		if got := api.IsNotFound(tc.err); got != tc.notFound {
+			t.Errorf("%s: IsNotFound = %v", tc.name, got)
+		}
+		if got := api.IsConflict(tc.err); got != tc.conflict {
+			t.Errorf("%s: IsConflict = %v", tc.name, got)
+		}
+		if got := api.IsRetryable(tc.err); got != tc.retryable {
+			t.Errorf("%s: IsRetryable = %v", tc.name, got)
+		}
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	for _, tc := range []struct {
+		err  *api.Error
+		want string
+	}{
+		{&api.Error{Op: "delete", Kind: "disk", ID: "d1", StatusCode: 404, Body: map[string]interface{}{"message": "gone"}},
+			"delete disk d1 failed: 404 Not Found: gone"},
+		{&api.Error{Op: "list", Kind: "disks", StatusCode: 503},
+			"list disks failed: 503 Service Unavailable"},
+		{&api.Error{Op: "create", Kind: "disk", Err: errors.New("connection refused")},
+			"create disk failed: connection refused"},
+	} {
+		if got := tc.err.Error(); got != tc.want {
+			t.Errorf("got %q, expected %q", got, tc.want)
+		}
+	}
+}
+
+func TestErrorFromServer(t *testing.T) {
+	srv := hypercloudtest.NewServer()
+	defer srv.Close()
+	srv.Seed()
+
+	_, err := api.DiskInfo(srv.Client(), "disk-9999")
+	if !api.IsNotFound(err) {
+		t.Fatalf("DiskInfo error %v, expected a 404", err)
+	}
+	var e *api.Error
+	if !errors.As(err, &e) || e.ID != "disk-9999" || e.Kind != "disk" {
+		t.Errorf("got %#v, expected an *api.Error for disk disk-9999", err)
+	}
+}
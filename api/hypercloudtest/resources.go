@@ -0,0 +1,480 @@
+package hypercloudtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/thehypercloud/packer-hypercloud/api"
+)
+
+// transition is a pending change of state, applied once the resource has
+// been read enough times
+type transition struct {
+	to    string
+	polls int
+	then  func()
+}
+
+type stateful struct {
+	state   string
+	pending *transition
+}
+
+// moveTo puts the resource into a transitional state which settles into
+// to after the server's configured number of polls
+func (s *Server) moveTo(r *stateful, via string, to string, then func()) {
+	r.state = via
+	r.pending = &transition{to: to, polls: s.Polls, then: then}
+}
+
+func (r *stateful) advance() {
+	if r.pending == nil {
+		return
+	}
+	r.pending.polls--
+	if r.pending.polls > 0 {
+		return
+	}
+	t := r.pending
+	r.pending = nil
+	r.state = t.to
+	if t.then != nil {
+		t.then()
+	}
+}
+
+type region struct {
+	id   string
+	name string
+}
+
+type tier struct {
+	id     string
+	name   string
+	region string
+}
+
+type network struct {
+	id      string
+	name    string
+	region  string
+	subnet  *net.IPNet
+	gateway string
+	lastIP  int
+}
+
+type ipAddress struct {
+	id       string
+	name     string
+	network  string
+	address  string
+	instance string
+	tags     map[string]string
+	created  time.Time
+}
+
+type template struct {
+	id      string
+	name    string
+	slug    string
+	version int
+	region  string
+	disk    string
+	tags    map[string]string
+	created time.Time
+}
+
+type disk struct {
+	stateful
+	id          string
+	name        string
+	description string
+	size        uint
+	cdrom       bool
+	region      string
+	tier        string
+	template    string
+	instance    string
+	tags        map[string]string
+	created     time.Time
+}
+
+type instance struct {
+	stateful
+	id         string
+	name       string
+	memory     uint
+	region     string
+	tier       string
+	bootDevice string
+	disks      []string
+	ips        []string
+	publicKeys []string
+	tags       map[string]string
+	created    time.Time
+}
+
+type publicKey struct {
+	id   string
+	name string
+	key  string
+}
+
+type consoleSession struct {
+	stateful
+	id          string
+	instance    string
+	consoleType string
+}
+
+func (s *Server) renderRegion(id string) map[string]interface{} {
+	r, ok := s.regions[id]
+	if !ok {
+		return map[string]interface{}{"id": id}
+	}
+	return map[string]interface{}{"id": r.id, "name": r.name}
+}
+
+func (s *Server) renderTier(t *tier) map[string]interface{} {
+	return map[string]interface{}{
+		"id":     t.id,
+		"name":   t.name,
+		"region": s.renderRegion(t.region),
+	}
+}
+
+func (s *Server) renderNetwork(n *network) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            n.id,
+		"name":          n.name,
+		"netmask":       net.IP(n.subnet.Mask).String(),
+		"gateway":       n.gateway,
+		"specification": n.subnet.String(),
+		"region":        s.renderRegion(n.region),
+	}
+}
+
+func (s *Server) renderIP(ip *ipAddress) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          ip.id,
+		"name":        ip.name,
+		"address":     ip.address,
+		"network":     ip.network,
+		"instance_id": ip.instance,
+		"tags":        ip.tags,
+		"created_at":  ip.created.Format(time.RFC3339),
+	}
+}
+
+func (s *Server) renderTemplate(t *template) map[string]interface{} {
+	var size uint
+	if d, ok := s.disks[t.disk]; ok {
+		size = d.size
+	}
+	return map[string]interface{}{
+		"id":         t.id,
+		"name":       t.name,
+		"slug":       t.slug,
+		"version":    t.version,
+		"size":       size,
+		"region":     s.renderRegion(t.region),
+		"tags":       t.tags,
+		"created_at": t.created.Format(time.RFC3339),
+	}
+}
+
+func (s *Server) renderDisk(d *disk) map[string]interface{} {
+	position := -1
+	if inst, ok := s.instances[d.instance]; ok {
+		for i, id := range inst.disks {
+			if id == d.id {
+				position = i
+			}
+		}
+	}
+	return map[string]interface{}{
+		"id":               d.id,
+		"name":             d.name,
+		"description":      d.description,
+		"state":            d.state,
+		"size":             d.size,
+		"cdrom":            d.cdrom,
+		"position":         position,
+		"instance_id":      d.instance,
+		"performance_tier": d.tier,
+		"template":         d.template,
+		"region":           s.renderRegion(d.region),
+		"tags":             d.tags,
+		"created_at":       d.created.Format(time.RFC3339),
+	}
+}
+
+func (s *Server) renderInstance(inst *instance) map[string]interface{} {
+	disks := make([]map[string]interface{}, 0, len(inst.disks))
+	for _, id := range inst.disks {
+		if d, ok := s.disks[id]; ok {
+			disks = append(disks, s.renderDisk(d))
+		}
+	}
+	adapters := make([]map[string]interface{}, 0, len(inst.ips))
+	for _, id := range inst.ips {
+		if ip, ok := s.ips[id]; ok {
+			adapters = append(adapters, map[string]interface{}{
+				"id":           "adapter-" + ip.id,
+				"ip_addresses": []map[string]interface{}{s.renderIP(ip)},
+			})
+		}
+	}
+	return map[string]interface{}{
+		"id":               inst.id,
+		"name":             inst.name,
+		"state":            inst.state,
+		"memory":           inst.memory,
+		"boot_device":      inst.bootDevice,
+		"performance_tier": inst.tier,
+		"region":           s.renderRegion(inst.region),
+		"disks":            disks,
+		"network_adapters": adapters,
+		"public_keys":      inst.publicKeys,
+		"tags":             inst.tags,
+		"created_at":       inst.created.Format(time.RFC3339),
+	}
+}
+
+func (s *Server) renderPublicKey(k *publicKey) map[string]interface{} {
+	return map[string]interface{}{"id": k.id, "name": k.name, "key": k.key}
+}
+
+func (s *Server) renderConsoleSession(c *consoleSession) map[string]interface{} {
+	session := map[string]interface{}{
+		"id":          c.id,
+		"state":       c.state,
+		"type":        c.consoleType,
+		"instance_id": c.instance,
+	}
+	if c.state == "ready" {
+		session["token"] = "token-" + c.id
+		session["host"] = "127.0.0.1"
+		session["port"] = 5900
+		session["url"] = fmt.Sprintf("%s/console/%s", s.URL, c.id)
+	}
+	return session
+}
+
+// Fixture holds the ids of the resources created by Seed
+type Fixture struct {
+	RegionID          string
+	NetworkID         string
+	TemplateID        string
+	DiskTierID        string
+	InstanceTierID    string
+	DownloaderID      string
+	DownloaderDiskID  string
+	DownloaderAddress string
+}
+
+// Seed creates a region with a network, a template, a performance tier of
+// each kind and a stopped downloader instance: everything a build needs.
+func (s *Server) Seed() Fixture {
+	var f Fixture
+	f.RegionID = s.AddRegion("test")
+	f.NetworkID = s.AddNetwork(f.RegionID, "test network", "10.0.0.0/24")
+	f.TemplateID = s.AddTemplate(f.RegionID, "Ubuntu 16.04", "ubuntu-16.04", 1)
+	f.DiskTierID = s.AddDiskTier(f.RegionID, "standard")
+	f.InstanceTierID = s.AddInstanceTier(f.RegionID, "standard")
+	f.DownloaderDiskID = s.AddDisk(f.RegionID, "downloader", 10)
+	f.DownloaderID = s.AddInstance(f.RegionID, "downloader", "stopped", f.DownloaderDiskID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ip := s.allocateIP(f.NetworkID, "downloader")
+	ip.instance = f.DownloaderID
+	s.instances[f.DownloaderID].ips = []string{ip.id}
+	f.DownloaderAddress = ip.address
+	return f
+}
+
+func (s *Server) AddRegion(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.newID("region")
+	s.regions[id] = &region{id: id, name: name}
+	return id
+}
+
+// AddNetwork adds a network for the CIDR specification, e.g. "10.0.0.0/24".
+// The first address in the network is its gateway.
+func (s *Server) AddNetwork(region string, name string, specification string) string {
+	_, subnet, err := net.ParseCIDR(specification)
+	if err != nil {
+		panic(fmt.Sprintf("hypercloudtest: invalid network specification %q: %s", specification, err))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.newID("network")
+	s.networks[id] = &network{
+		id:      id,
+		name:    name,
+		region:  region,
+		subnet:  subnet,
+		gateway: nthAddress(subnet, 1),
+		lastIP:  9,
+	}
+	return id
+}
+
+func (s *Server) AddTemplate(region string, name string, slug string, version int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.newID("template")
+	s.templates[id] = &template{id: id, name: name, slug: slug, version: version, region: region, created: time.Now()}
+	return id
+}
+
+func (s *Server) AddDiskTier(region string, name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.newID("disk-tier")
+	s.diskTiers[id] = &tier{id: id, name: name, region: region}
+	return id
+}
+
+func (s *Server) AddInstanceTier(region string, name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.newID("instance-tier")
+	s.instanceTiers[id] = &tier{id: id, name: name, region: region}
+	return id
+}
+
+// AddDisk adds an unattached disk of size gigabytes
+func (s *Server) AddDisk(region string, name string, size uint) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.newID("disk")
+	d := &disk{id: id, name: name, size: size, region: region, created: time.Now()}
+	d.state = "unattached"
+	s.disks[id] = d
+	return id
+}
+
+// AddInstance adds an instance in state with the given disks attached
+func (s *Server) AddInstance(region string, name string, state string, diskids ...string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.newID("instance")
+	inst := &instance{id: id, name: name, memory: 512, region: region, bootDevice: "disk", created: time.Now()}
+	inst.state = state
+	s.instances[id] = inst
+	for _, diskid := range diskids {
+		if d, ok := s.disks[diskid]; ok {
+			d.state = "attached"
+			d.instance = id
+			inst.disks = append(inst.disks, diskid)
+		}
+	}
+	return id
+}
+
+// Backdate makes the disk, instance, ip address or template with id appear to have
+// been created age ago
+func (s *Server) Backdate(id string, age time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	created := time.Now().Add(-age)
+	if d, ok := s.disks[id]; ok {
+		d.created = created
+	}
+	if inst, ok := s.instances[id]; ok {
+		inst.created = created
+	}
+	if ip, ok := s.ips[id]; ok {
+		ip.created = created
+	}
+	if t, ok := s.templates[id]; ok {
+		t.created = created
+	}
+}
+
+// Disk returns the current state of a disk as the api package sees it
+func (s *Server) Disk(id string) (disk api.Disk, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.disks[id]
+	if !ok {
+		return disk, false
+	}
+	return disk, convert(s.renderDisk(d), &disk)
+}
+
+// Instance returns the current state of an instance as the api package
+// sees it
+func (s *Server) Instance(id string) (instance api.Instance, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst, ok := s.instances[id]
+	if !ok {
+		return instance, false
+	}
+	return instance, convert(s.renderInstance(inst), &instance)
+}
+
+// DiskIDs returns the ids of every disk, sorted
+func (s *Server) DiskIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.disks))
+	for id := range s.disks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// AllocatedIPs returns the ids of every allocated ip address, sorted
+func (s *Server) AllocatedIPs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.ips))
+	for id := range s.ips {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func convert(in interface{}, out interface{}) bool {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, out) == nil
+}
+
+func nthAddress(subnet *net.IPNet, n int) string {
+	ip := make(net.IP, len(subnet.IP))
+	copy(ip, subnet.IP)
+	for i := len(ip) - 1; i >= 0 && n > 0; i-- {
+		sum := int(ip[i]) + n
+		ip[i] = byte(sum % 256)
+		n = sum / 256
+	}
+	return ip.String()
+}
+
+func (s *Server) allocateIP(networkid string, name string) *ipAddress {
+	n := s.networks[networkid]
+	n.lastIP++
+	ip := &ipAddress{
+		id:      s.newID("ip"),
+		name:    name,
+		network: networkid,
+		address: nthAddress(n.subnet, n.lastIP),
+		created: time.Now(),
+	}
+	s.ips[ip.id] = ip
+	return ip
+}
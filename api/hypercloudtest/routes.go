@@ -0,0 +1,631 @@
+package hypercloudtest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// route dispatches a request, with the path split into its segments below
+// APIPrefix. The caller holds s.mu.
+func (s *Server) route(method string, parts []string, params map[string]interface{}) (int, interface{}) {
+	switch parts[0] {
+	case "instances":
+		return s.routeInstances(method, parts, params)
+	case "disks":
+		return s.routeDisks(method, parts, params)
+	case "ip_addresses":
+		return s.routeIPAddresses(method, parts, params)
+	case "networks":
+		return s.routeNetworks(method, parts)
+	case "templates":
+		return s.routeTemplates(method, parts, params)
+	case "performance_tiers":
+		return s.routePerformanceTiers(method, parts)
+	case "regions":
+		if method == "GET" && len(parts) == 1 {
+			list := make([]map[string]interface{}, 0, len(s.regions))
+			for _, id := range sortedKeys(s.regions) {
+				list = append(list, s.renderRegion(id))
+			}
+			return http.StatusOK, list
+		}
+	case "public_keys":
+		return s.routePublicKeys(method, parts, params)
+	case "console_sessions":
+		if method == "GET" && len(parts) == 2 {
+			c, ok := s.consoleSession[parts[1]]
+			if !ok {
+				return notFound("console session", parts[1])
+			}
+			c.advance()
+			return http.StatusOK, s.renderConsoleSession(c)
+		}
+	}
+	return noRoute(method, parts)
+}
+
+func (s *Server) routeInstances(method string, parts []string, params map[string]interface{}) (int, interface{}) {
+	if len(parts) == 1 {
+		switch method {
+		case "GET":
+			list := make([]map[string]interface{}, 0, len(s.instances))
+			for _, id := range sortedKeys(s.instances) {
+				list = append(list, s.renderInstance(s.instances[id]))
+			}
+			return http.StatusOK, list
+		}
+		return noRoute(method, parts)
+	}
+	if parts[1] == "assemble" {
+		if method == "POST" && len(parts) == 2 {
+			return s.createInstance(params)
+		}
+		return noRoute(method, parts)
+	}
+
+	inst, ok := s.instances[parts[1]]
+	if !ok {
+		return notFound("instance", parts[1])
+	}
+	action := ""
+	if len(parts) > 2 {
+		action = parts[2]
+	}
+
+	switch method + " " + action {
+	case "GET ":
+		s.advanceInstance(inst)
+		return http.StatusOK, s.renderInstance(inst)
+	case "GET state":
+		s.advanceInstance(inst)
+		return http.StatusOK, map[string]interface{}{"state": inst.state}
+	case "PUT ":
+		if name, ok := params["name"].(string); ok {
+			inst.name = name
+		}
+		if memory, ok := uintParam(params, "memory"); ok {
+			inst.memory = memory
+		}
+		if boot, ok := params["boot_device"].(string); ok {
+			inst.bootDevice = boot
+		}
+		return http.StatusOK, s.renderInstance(inst)
+	case "PUT public_keys":
+		inst.publicKeys = stringsParam(params, "public_keys")
+		list := make([]map[string]interface{}, 0, len(inst.publicKeys))
+		for _, id := range inst.publicKeys {
+			if k, ok := s.publicKeys[id]; ok {
+				list = append(list, s.renderPublicKey(k))
+			}
+		}
+		return http.StatusOK, list
+	case "PUT disks":
+		return s.updateInstanceDisks(inst, stringsParam(params, "disks"))
+	case "PUT network_adapters":
+		adapters, _ := params["network_adapters"].([]interface{})
+		if len(adapters) != 0 {
+			return http.StatusUnprocessableEntity, errorBody("only removing all network adapters is supported")
+		}
+		for _, id := range inst.ips {
+			if ip, ok := s.ips[id]; ok {
+				ip.instance = ""
+			}
+		}
+		inst.ips = nil
+		return http.StatusOK, []map[string]interface{}{}
+	case "POST start":
+		if inst.state != "stopped" {
+			return http.StatusConflict, errorBody("instance %s is %s, not stopped", inst.id, inst.state)
+		}
+		s.moveTo(&inst.stateful, "starting", "running", nil)
+		return http.StatusOK, s.renderInstance(inst)
+	case "POST stop":
+		if inst.state != "running" {
+			return http.StatusConflict, errorBody("instance %s is %s, not running", inst.id, inst.state)
+		}
+		s.moveTo(&inst.stateful, "stopping", "stopped", nil)
+		return http.StatusOK, s.renderInstance(inst)
+	case "POST remote_access":
+		if inst.state != "running" && inst.state != "starting" {
+			return http.StatusConflict, errorBody("instance %s is %s, not running", inst.id, inst.state)
+		}
+		consoleType, _ := params["type"].(string)
+		if consoleType == "" {
+			consoleType = "vnc"
+		}
+		c := &consoleSession{id: s.newID("console"), instance: inst.id, consoleType: consoleType}
+		s.moveTo(&c.stateful, "pending", "ready", nil)
+		s.consoleSession[c.id] = c
+		return http.StatusCreated, s.renderConsoleSession(c)
+	case "DELETE ":
+		if inst.state == "terminating" || inst.state == "terminated" {
+			return http.StatusOK, s.renderInstance(inst)
+		}
+		s.moveTo(&inst.stateful, "terminating", "terminated", func() {
+			for _, id := range inst.disks {
+				if d, ok := s.disks[id]; ok {
+					d.state = "unattached"
+					d.instance = ""
+				}
+			}
+			for _, id := range inst.ips {
+				if ip, ok := s.ips[id]; ok {
+					ip.instance = ""
+				}
+			}
+			inst.disks = nil
+			inst.ips = nil
+		})
+		return http.StatusOK, s.renderInstance(inst)
+	}
+	return noRoute(method, parts)
+}
+
+// advanceInstance moves the instance and its disks, including any still
+// detaching from it, one poll closer to their next state
+func (s *Server) advanceInstance(inst *instance) {
+	inst.advance()
+	for _, d := range s.disks {
+		if d.instance == inst.id {
+			d.advance()
+		}
+	}
+}
+
+func (s *Server) createInstance(params map[string]interface{}) (int, interface{}) {
+	name, _ := params["name"].(string)
+	memory, _ := uintParam(params, "memory")
+	tierid, _ := params["performance_tier"].(string)
+	regionid, _ := params["region"].(string)
+	boot, _ := params["boot_device"].(string)
+
+	if _, ok := s.instanceTiers[tierid]; !ok {
+		return http.StatusUnprocessableEntity, errorBody("unknown instance performance tier %q", tierid)
+	}
+	if _, ok := s.regions[regionid]; !ok {
+		return http.StatusUnprocessableEntity, errorBody("unknown region %q", regionid)
+	}
+	diskids := stringsParam(params, "disks")
+	for _, id := range diskids {
+		d, ok := s.disks[id]
+		if !ok {
+			return http.StatusUnprocessableEntity, errorBody("unknown disk %q", id)
+		}
+		if d.instance != "" || d.state != "unattached" {
+			return http.StatusConflict, errorBody("disk %s is %s", id, d.state)
+		}
+	}
+	ipids := stringsParam(params, "ip_addresses")
+	for _, id := range ipids {
+		ip, ok := s.ips[id]
+		if !ok {
+			return http.StatusUnprocessableEntity, errorBody("unknown ip address %q", id)
+		}
+		if ip.instance != "" {
+			return http.StatusConflict, errorBody("ip address %s is in use", id)
+		}
+	}
+
+	inst := &instance{
+		id:         s.newID("instance"),
+		name:       name,
+		memory:     memory,
+		region:     regionid,
+		tier:       tierid,
+		bootDevice: boot,
+		disks:      diskids,
+		ips:        ipids,
+		tags:       tagsParam(params),
+		created:    time.Now(),
+	}
+	inst.state = "stopped"
+	for _, id := range diskids {
+		s.disks[id].state = "attached"
+		s.disks[id].instance = inst.id
+	}
+	for _, id := range ipids {
+		s.ips[id].instance = inst.id
+	}
+	s.instances[inst.id] = inst
+	return http.StatusCreated, s.renderInstance(inst)
+}
+
+// updateInstanceDisks replaces the disks attached to an instance, and
+// returns them. Disks are attached and detached immediately on a stopped
+// instance, and go through attaching and detaching on a running one.
+func (s *Server) updateInstanceDisks(inst *instance, diskids []string) (int, interface{}) {
+	wanted := make(map[string]bool)
+	for _, id := range diskids {
+		d, ok := s.disks[id]
+		if !ok {
+			return http.StatusUnprocessableEntity, errorBody("unknown disk %q", id)
+		}
+		if d.instance != "" && d.instance != inst.id {
+			return http.StatusConflict, errorBody("disk %s is attached to instance %s", id, d.instance)
+		}
+		wanted[id] = true
+	}
+	live := inst.state == "running"
+
+	for _, id := range inst.disks {
+		if wanted[id] {
+			continue
+		}
+		d := s.disks[id]
+		if live {
+			s.moveTo(&d.stateful, "detaching", "unattached", func() { d.instance = "" })
+		} else {
+			d.state = "unattached"
+			d.instance = ""
+		}
+	}
+	for _, id := range diskids {
+		d := s.disks[id]
+		if d.instance == inst.id {
+			continue
+		}
+		d.instance = inst.id
+		if live {
+			s.moveTo(&d.stateful, "attaching", "attached", nil)
+		} else {
+			d.state = "attached"
+		}
+	}
+	inst.disks = diskids
+	list := make([]map[string]interface{}, 0, len(diskids))
+	for _, id := range diskids {
+		list = append(list, s.renderDisk(s.disks[id]))
+	}
+	return http.StatusOK, list
+}
+
+func (s *Server) routeDisks(method string, parts []string, params map[string]interface{}) (int, interface{}) {
+	if len(parts) == 1 {
+		switch method {
+		case "GET":
+			list := make([]map[string]interface{}, 0, len(s.disks))
+			for _, id := range sortedKeys(s.disks) {
+				list = append(list, s.renderDisk(s.disks[id]))
+			}
+			return http.StatusOK, list
+		case "POST":
+			return s.createDisk(params)
+		}
+		return noRoute(method, parts)
+	}
+
+	d, ok := s.disks[parts[1]]
+	if !ok {
+		return notFound("disk", parts[1])
+	}
+	if len(parts) == 3 && parts[2] == "clone" && method == "POST" {
+		return s.cloneDisk(d, params)
+	}
+	if len(parts) != 2 {
+		return noRoute(method, parts)
+	}
+	switch method {
+	case "GET":
+		d.advance()
+		return http.StatusOK, s.renderDisk(d)
+	case "PUT":
+		if name, ok := params["name"].(string); ok {
+			d.name = name
+		}
+		if description, ok := params["description"].(string); ok {
+			d.description = description
+		}
+		if size, ok := uintParam(params, "size"); ok {
+			d.size = size
+		}
+		if cdrom, ok := params["cdrom"].(bool); ok {
+			d.cdrom = cdrom
+		}
+		if _, ok := params["tags"]; ok {
+			d.tags = tagsParam(params)
+		}
+		return http.StatusOK, s.renderDisk(d)
+	case "DELETE":
+		if d.instance != "" {
+			return http.StatusConflict, errorBody("disk %s is attached to instance %s", d.id, d.instance)
+		}
+		delete(s.disks, d.id)
+		return http.StatusOK, map[string]interface{}{}
+	}
+	return noRoute(method, parts)
+}
+
+func (s *Server) createDisk(params map[string]interface{}) (int, interface{}) {
+	name, _ := params["name"].(string)
+	size, _ := uintParam(params, "size")
+	regionid, _ := params["region"].(string)
+	tierid, _ := params["performance_tier"].(string)
+	templateid, _ := params["template"].(string)
+
+	if _, ok := s.regions[regionid]; !ok {
+		return http.StatusUnprocessableEntity, errorBody("unknown region %q", regionid)
+	}
+	if _, ok := s.diskTiers[tierid]; !ok {
+		return http.StatusUnprocessableEntity, errorBody("unknown disk performance tier %q", tierid)
+	}
+	if templateid != "" {
+		if _, ok := s.templates[templateid]; !ok {
+			return http.StatusUnprocessableEntity, errorBody("unknown template %q", templateid)
+		}
+	}
+	if size == 0 {
+		return http.StatusUnprocessableEntity, errorBody("size must be greater than 0")
+	}
+
+	d := &disk{
+		id:       s.newID("disk"),
+		name:     name,
+		size:     size,
+		region:   regionid,
+		tier:     tierid,
+		template: templateid,
+		tags:     tagsParam(params),
+		created:  time.Now(),
+	}
+	s.moveTo(&d.stateful, "creating", "unattached", nil)
+	s.disks[d.id] = d
+	return http.StatusCreated, s.renderDisk(d)
+}
+
+// cloneDisk copies an unattached disk, into the region and tier given or
+// else those of the source. The apiclient's Clone takes any body, so the
+// name, region, performance_tier and tags accepted here are what api sends,
+// unchecked against a HyperCloud.
+func (s *Server) cloneDisk(source *disk, params map[string]interface{}) (int, interface{}) {
+	if source.instance != "" {
+		return http.StatusConflict, errorBody("disk %s is attached to instance %s", source.id, source.instance)
+	}
+	name, _ := params["name"].(string)
+	regionid, _ := params["region"].(string)
+	tierid, _ := params["performance_tier"].(string)
+	if regionid == "" {
+		regionid = source.region
+	}
+	if tierid == "" {
+		tierid = source.tier
+	}
+	if _, ok := s.regions[regionid]; !ok {
+		return http.StatusUnprocessableEntity, errorBody("unknown region %q", regionid)
+	}
+	if _, ok := s.diskTiers[tierid]; !ok {
+		return http.StatusUnprocessableEntity, errorBody("unknown disk performance tier %q", tierid)
+	}
+
+	d := &disk{
+		id:       s.newID("disk"),
+		name:     name,
+		size:     source.size,
+		region:   regionid,
+		tier:     tierid,
+		template: source.template,
+		tags:     tagsParam(params),
+		created:  time.Now(),
+	}
+	s.moveTo(&d.stateful, "creating", "unattached", nil)
+	s.disks[d.id] = d
+	return http.StatusCreated, s.renderDisk(d)
+}
+
+func (s *Server) routeIPAddresses(method string, parts []string, params map[string]interface{}) (int, interface{}) {
+	switch {
+	case method == "GET" && len(parts) == 1:
+		list := make([]map[string]interface{}, 0, len(s.ips))
+		for _, id := range sortedKeys(s.ips) {
+			list = append(list, s.renderIP(s.ips[id]))
+		}
+		return http.StatusOK, list
+	case method == "POST" && len(parts) == 1:
+		networkid, _ := params["network"].(string)
+		if _, ok := s.networks[networkid]; !ok {
+			return http.StatusUnprocessableEntity, errorBody("unknown network %q", networkid)
+		}
+		name, _ := params["name"].(string)
+		ip := s.allocateIP(networkid, name)
+		ip.tags = tagsParam(params)
+		return http.StatusCreated, s.renderIP(ip)
+	case method == "DELETE" && len(parts) == 2:
+		ip, ok := s.ips[parts[1]]
+		if !ok {
+			return notFound("ip address", parts[1])
+		}
+		if ip.instance != "" {
+			return http.StatusConflict, errorBody("ip address %s is in use by instance %s", ip.id, ip.instance)
+		}
+		delete(s.ips, ip.id)
+		return http.StatusOK, map[string]interface{}{}
+	}
+	return noRoute(method, parts)
+}
+
+func (s *Server) routeNetworks(method string, parts []string) (int, interface{}) {
+	if method != "GET" {
+		return noRoute(method, parts)
+	}
+	if len(parts) == 1 {
+		list := make([]map[string]interface{}, 0, len(s.networks))
+		for _, id := range sortedKeys(s.networks) {
+			list = append(list, s.renderNetwork(s.networks[id]))
+		}
+		return http.StatusOK, list
+	}
+	n, ok := s.networks[parts[1]]
+	if !ok {
+		return notFound("network", parts[1])
+	}
+	return http.StatusOK, s.renderNetwork(n)
+}
+
+// routeTemplates serves the show and list calls of the apiclient, and the
+// create and delete requests api sends itself. Those two aren't in the
+// apiclient, so their shape is api's and hasn't been checked against a
+// HyperCloud: a create takes the disk, name, slug, version and tags, and
+// there are no server-side rules about versions.
+func (s *Server) routeTemplates(method string, parts []string, params map[string]interface{}) (int, interface{}) {
+	switch {
+	case method == "GET" && len(parts) == 1:
+		list := make([]map[string]interface{}, 0, len(s.templates))
+		for _, id := range sortedKeys(s.templates) {
+			list = append(list, s.renderTemplate(s.templates[id]))
+		}
+		return http.StatusOK, list
+	case method == "GET" && len(parts) == 2:
+		t, ok := s.templates[parts[1]]
+		if !ok {
+			return notFound("template", parts[1])
+		}
+		return http.StatusOK, s.renderTemplate(t)
+	case method == "POST" && len(parts) == 1:
+		diskid, _ := params["disk"].(string)
+		d, ok := s.disks[diskid]
+		if !ok {
+			return http.StatusUnprocessableEntity, errorBody("unknown disk %q", diskid)
+		}
+		name, _ := params["name"].(string)
+		slug, _ := params["slug"].(string)
+		version, _ := uintParam(params, "version")
+		t := &template{
+			id:      s.newID("template"),
+			name:    name,
+			slug:    slug,
+			version: int(version),
+			region:  d.region,
+			disk:    d.id,
+			tags:    tagsParam(params),
+			created: time.Now(),
+		}
+		s.templates[t.id] = t
+		return http.StatusCreated, s.renderTemplate(t)
+	case method == "DELETE" && len(parts) == 2:
+		if _, ok := s.templates[parts[1]]; !ok {
+			return notFound("template", parts[1])
+		}
+		delete(s.templates, parts[1])
+		return http.StatusOK, map[string]interface{}{}
+	}
+	return noRoute(method, parts)
+}
+
+func (s *Server) routePerformanceTiers(method string, parts []string) (int, interface{}) {
+	if method != "GET" || len(parts) != 2 {
+		return noRoute(method, parts)
+	}
+	var tiers map[string]*tier
+	switch parts[1] {
+	case "disks":
+		tiers = s.diskTiers
+	case "instances":
+		tiers = s.instanceTiers
+	default:
+		return noRoute(method, parts)
+	}
+	list := make([]map[string]interface{}, 0, len(tiers))
+	for _, id := range sortedKeys(tiers) {
+		list = append(list, s.renderTier(tiers[id]))
+	}
+	return http.StatusOK, list
+}
+
+func (s *Server) routePublicKeys(method string, parts []string, params map[string]interface{}) (int, interface{}) {
+	if len(parts) != 1 {
+		return noRoute(method, parts)
+	}
+	switch method {
+	case "GET":
+		list := make([]map[string]interface{}, 0, len(s.publicKeys))
+		for _, id := range sortedKeys(s.publicKeys) {
+			list = append(list, s.renderPublicKey(s.publicKeys[id]))
+		}
+		return http.StatusOK, list
+	case "POST":
+		name, _ := params["name"].(string)
+		key, _ := params["key"].(string)
+		if key == "" {
+			return http.StatusUnprocessableEntity, errorBody("key is required")
+		}
+		k := &publicKey{id: s.newID("key"), name: name, key: key}
+		s.publicKeys[k.id] = k
+		return http.StatusCreated, s.renderPublicKey(k)
+	}
+	return noRoute(method, parts)
+}
+
+// sortedKeys returns the keys of any of the server's resource maps in a
+// stable order
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]*region:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*tier:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*network:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*ipAddress:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*template:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*disk:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*instance:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*publicKey:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	default:
+		panic(fmt.Sprintf("hypercloudtest: sortedKeys of %T", m))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func uintParam(params map[string]interface{}, key string) (uint, bool) {
+	n, ok := params[key].(float64)
+	if !ok || n < 0 {
+		return 0, false
+	}
+	return uint(n), true
+}
+
+func tagsParam(params map[string]interface{}) map[string]string {
+	raw, _ := params["tags"].(map[string]interface{})
+	tags := make(map[string]string, len(raw))
+	for k, v := range raw {
+		if s, ok := v.(string); ok {
+			tags[k] = s
+		}
+	}
+	return tags
+}
+
+func stringsParam(params map[string]interface{}, key string) []string {
+	raw, _ := params[key].([]interface{})
+	values := make([]string, 0, len(raw))
+	for _, v := range raw {
+		if s, ok := v.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
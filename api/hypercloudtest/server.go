@@ -0,0 +1,176 @@
+// Package hypercloudtest provides an in-process fake of the HyperCloud API,
+// for testing the api package and the builders without a live cloud.
+//
+// The server implements the endpoints used by the plugin: instances, disks,
+// ip addresses, networks, templates, performance tiers, regions, public
+// keys and console sessions. Resources move through the
+// same transitional states as on a real HyperCloud (e.g. a disk is
+// "attaching" before it is "attached"), settling after a configurable
+// number of reads so that the plugin's polling loops are exercised.
+//
+//	srv := hypercloudtest.NewServer()
+//	defer srv.Close()
+//	fixture := srv.Seed()
+//	client := srv.Client()
+package hypercloudtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/thehypercloud/packer-hypercloud/api"
+)
+
+// APIPrefix is the path under which the fake serves the HyperCloud API
+const APIPrefix = "/api/v1/"
+
+// Token is the access token handed out by the fake's oauth endpoint
+const Token = "hypercloudtest-token"
+
+type Server struct {
+	*httptest.Server
+
+	// Polls is the number of times a resource in a transitional state must
+	// be read before it settles. Defaults to 1.
+	Polls int
+
+	mu       sync.Mutex
+	nextID   int
+	requests []string
+	failures []*failure
+
+	regions        map[string]*region
+	networks       map[string]*network
+	ips            map[string]*ipAddress
+	templates      map[string]*template
+	diskTiers      map[string]*tier
+	instanceTiers  map[string]*tier
+	disks          map[string]*disk
+	instances      map[string]*instance
+	publicKeys     map[string]*publicKey
+	consoleSession map[string]*consoleSession
+}
+
+type failure struct {
+	method string
+	path   string
+	status int
+	times  int
+}
+
+// NewServer starts a fake HyperCloud with no resources. Call Close when
+// finished with it.
+func NewServer() *Server {
+	s := &Server{
+		Polls:          1,
+		regions:        make(map[string]*region),
+		networks:       make(map[string]*network),
+		ips:            make(map[string]*ipAddress),
+		templates:      make(map[string]*template),
+		diskTiers:      make(map[string]*tier),
+		instanceTiers:  make(map[string]*tier),
+		disks:          make(map[string]*disk),
+		instances:      make(map[string]*instance),
+		publicKeys:     make(map[string]*publicKey),
+		consoleSession: make(map[string]*consoleSession),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Client returns an api client authenticated against the fake server
+func (s *Server) Client() *api.Client {
+	return api.Connect(api.Endpoint{URL: s.URL, AccessToken: Token})
+}
+
+// Fail makes the next times requests whose method matches and whose path,
+// relative to APIPrefix, starts with path fail with status. An empty method
+// matches any method.
+func (s *Server) Fail(method string, path string, status int, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, &failure{
+		method: method,
+		path:   strings.TrimPrefix(path, "/"),
+		status: status,
+		times:  times,
+	})
+}
+
+// Requests returns every request received so far, as "METHOD path"
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) newID(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s-%04d", prefix, s.nextID)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	if r.URL.Path == "/oauth/token" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token": Token,
+			"token_type":   "bearer",
+			"expires_in":   7200,
+		})
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, APIPrefix) {
+		writeError(w, http.StatusNotFound, "no route for %s", r.URL.Path)
+		return
+	}
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, APIPrefix), "/")
+
+	for _, f := range s.failures {
+		if f.times > 0 && (f.method == "" || f.method == r.Method) && strings.HasPrefix(path, f.path) {
+			f.times--
+			writeError(w, f.status, "injected failure")
+			return
+		}
+	}
+
+	params := make(map[string]interface{})
+	if r.Body != nil && (r.Method == "POST" || r.Method == "PUT" || r.Method == "PATCH") {
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil && err.Error() != "EOF" {
+			writeError(w, http.StatusBadRequest, "invalid json body: %s", err)
+			return
+		}
+	}
+
+	status, body := s.route(r.Method, strings.Split(path, "/"), params)
+	writeJSON(w, status, body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJSON(w, status, errorBody(format, args...))
+}
+
+func errorBody(format string, args ...interface{}) map[string]interface{} {
+	return map[string]interface{}{"message": fmt.Sprintf(format, args...)}
+}
+
+func notFound(kind string, id string) (int, interface{}) {
+	return http.StatusNotFound, errorBody("%s %s not found", kind, id)
+}
+
+func noRoute(method string, parts []string) (int, interface{}) {
+	return http.StatusNotFound, errorBody("no route for %s %s", method, strings.Join(parts, "/"))
+}
@@ -1,25 +1,104 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"time"
-
-	"github.com/thehypercloud/apiclient-go"
 )
 
-func InstanceInfo(api *hypercloud.ApiClient, instanceId string) (disk map[string]interface{}, err error) {
-	status, disk, error := api.Instance.Show(instanceId)
-	if error != nil {
-		return nil, error
+type Instance struct {
+	ID              string           `json:"id"`
+	Name            string           `json:"name"`
+	State           string           `json:"state"`
+	Memory          uint             `json:"memory"`
+	BootDevice      string           `json:"boot_device"`
+	Disks           []Disk           `json:"disks"`
+	NetworkAdapters []NetworkAdapter `json:"network_adapters"`
+	Tags            Tags             `json:"tags"`
+	CreatedAt       Timestamp        `json:"created_at"`
+}
+
+func (i *Instance) validate() error {
+	if err := requireFields("instance", "id", i.ID, "state", i.State); err != nil {
+		return err
+	}
+	for j := range i.Disks {
+		if err := requireFields("instance disk", "id", i.Disks[j].ID); err != nil {
+			return err
+		}
+	}
+	for j := range i.NetworkAdapters {
+		for k := range i.NetworkAdapters[j].IPAddresses {
+			if err := i.NetworkAdapters[j].IPAddresses[k].validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DiskIDs returns the ids of all disks attached to the instance
+func (i *Instance) DiskIDs() []string {
+	ids := make([]string, len(i.Disks))
+	for j := range i.Disks {
+		ids[j] = i.Disks[j].ID
+	}
+	return ids
+}
+
+// FirstIPAddress returns the first address of the first network adapter
+func (i *Instance) FirstIPAddress() (string, error) {
+	if len(i.NetworkAdapters) == 0 || len(i.NetworkAdapters[0].IPAddresses) == 0 {
+		return "", fmt.Errorf("instance %s has no ip addresses", i.ID)
+	}
+	return i.NetworkAdapters[0].IPAddresses[0].Address, nil
+}
+
+type NetworkAdapter struct {
+	ID          string      `json:"id"`
+	IPAddresses []IPAddress `json:"ip_addresses"`
+}
+
+type instanceState struct {
+	State string `json:"state"`
+}
+
+func (s *instanceState) validate() error {
+	return requireFields("instance state", "state", s.State)
+}
+
+func InstanceInfo(api *Client, instanceId string) (instance *Instance, err error) {
+	raw, err := api.request(idempotent, "show", "instance", instanceId, func() (int, map[string]interface{}, error) {
+		return api.Instance.Show(instanceId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	instance = new(Instance)
+	if err := decode("instance", raw, instance); err != nil {
+		return nil, err
+	}
+	return instance, nil
+}
+
+func InstanceList(api *Client) (instances []Instance, err error) {
+	raw, err := api.requestList("list", "instances", func() (int, []map[string]interface{}, error) {
+		return api.Instance.List()
+	})
+	if err != nil {
+		return nil, err
 	}
-	if status < 200 || status >= 300 {
-		return disk, fmt.Errorf("%d : %s", status, disk)
+	instances = make([]Instance, len(raw))
+	for i := range raw {
+		if err := decode("instance", raw[i], &instances[i]); err != nil {
+			return nil, err
+		}
 	}
-	return disk, nil
+	return instances, nil
 }
 
-func InstanceCreate(api *hypercloud.ApiClient, name string, memory uint, tier string, region string, diskids []string, ipids []string, boot_device string) (instance map[string]interface{}, err error) {
-	args := map[string]interface{}{
+func InstanceCreate(api *Client, name string, memory uint, tier string, region string, diskids []string, ipids []string, boot_device string, tags Tags) (instance *Instance, err error) {
+	args := tags.addTo(map[string]interface{}{
 		"name":              name,
 		"memory":            memory,
 		"performance_tier":  tier,
@@ -31,144 +110,117 @@ func InstanceCreate(api *hypercloud.ApiClient, name string, memory uint, tier st
 		"start_on_shutdown": false,
 		"start_on_reboot":   true,
 		"start_on_crash":    false,
-	}
+	})
 
-	status, result, err := api.Instance.Create_advanced(args)
+	result, err := api.request(mutating, "create", "instance", "", func() (int, map[string]interface{}, error) {
+		return api.Instance.Create_advanced(args)
+	})
 	if err != nil {
 		return nil, err
 	}
-	if status < 200 || status >= 300 {
-		return result, fmt.Errorf("%d : %s", status, result)
+	instance = new(Instance)
+	if err := decode("instance", result, instance); err != nil {
+		return nil, err
 	}
-	return result, nil
+	return instance, nil
 }
 
-func InstanceUpdate(api *hypercloud.ApiClient, instanceid string, data map[string]interface{}) (instance map[string]interface{}, err error) {
-	status, result, err := api.Instance.Update(instanceid, data)
+func InstanceUpdate(api *Client, instanceid string, data map[string]interface{}) (instance *Instance, err error) {
+	result, err := api.request(idempotent, "update", "instance", instanceid, func() (int, map[string]interface{}, error) {
+		return api.Instance.Update(instanceid, data)
+	})
 	if err != nil {
 		return nil, err
 	}
-	if status < 200 || status >= 300 {
-		return nil, fmt.Errorf("%d : %s", status, result)
+	instance = new(Instance)
+	if err := decode("instance", result, instance); err != nil {
+		return nil, err
 	}
-	return result, nil
+	return instance, nil
 }
 
-func InstanceUpdatePublicKeys(api *hypercloud.ApiClient, instanceid string, keys []string) (error) {
-	status, result, err := api.Instance.Update_public_keys(instanceid, map[string]interface{}{
-		"public_keys": keys,
+func InstanceUpdatePublicKeys(api *Client, instanceid string, keys []string) error {
+	_, err := api.requestArray(idempotent, "update public keys of", "instance", instanceid, func() (int, []map[string]interface{}, error) {
+		return api.Instance.Update_public_keys(instanceid, map[string]interface{}{
+			"public_keys": keys,
+		})
 	})
-	if err != nil {
-		return err
-	}
-	if status < 200 || status >= 300 {
-		return fmt.Errorf("%d : %s", status, result)
-	}
-	return nil
+	return err
 }
 
-
-func InstanceUpdateDisks(api *hypercloud.ApiClient, instanceid string, diskids []string) (err error) {
-	status, _, err := api.Instance.Update_disks(instanceid, map[string]interface{}{
-		"disks": diskids,
+func InstanceUpdateDisks(ctx context.Context, api *Client, instanceid string, diskids []string) (err error) {
+	_, err = api.requestArray(idempotent, "update disks of", "instance", instanceid, func() (int, []map[string]interface{}, error) {
+		return api.Instance.Update_disks(instanceid, map[string]interface{}{
+			"disks": diskids,
+		})
 	})
 	if err != nil {
 		return err
 	}
-	if status < 200 || status >= 300 {
-		return fmt.Errorf("error when getting instance info during update disks: %s", status)
-	}
 
 	instance, err := InstanceInfo(api, instanceid)
 	if err != nil {
 		return err
 	}
-	if instance["state"] == "stopped" {
+	if instance.State == "stopped" {
 		return nil
 	}
 
-	// Loop until live attach/detach has happened
-	for {
+	// Wait until live attach/detach has happened
+	what := fmt.Sprintf("disks of instance %s to attach/detach", instanceid)
+	return WaitFor(ctx, pollOptions(seconds(DEFAULT_TIMEOUT)), what, func() (bool, error) {
 		instance, err := InstanceInfo(api, instanceid)
 		if err != nil {
-			return err
+			return false, err
 		}
-		aching := 0
-		for i := range instance["disks"].([]interface{}) {
-			disks := instance["disks"].([]interface{})
-			disk := disks[i].(map[string]interface{})
-			if disk["state"] == "attaching" || disk["state"] == "detaching" {
-				aching += 1
+		for _, disk := range instance.Disks {
+			if disk.State == "attaching" || disk.State == "detaching" {
+				return false, nil
 			}
 		}
-		if aching == 0 {
-			break
-		}
-		time.Sleep(2) // Wait for live attach/detach
-	}
-	return nil
+		return true, nil
+	})
 }
 
-func InstanceRemoveDisk(api *hypercloud.ApiClient, instanceid string, diskid string) (err error) {
-	var new_disk_ids [100]string
+func InstanceRemoveDisk(ctx context.Context, api *Client, instanceid string, diskid string) (err error) {
 	instance, err := InstanceInfo(api, instanceid)
 	if err != nil {
 		return err
 	}
-	disks := instance["disks"].([]interface{})
-	disk_counter := 0
-	for i := range disks {
-		disk := disks[i].(map[string]interface{})
-		disk_id := disk["id"].(string)
-		if disk_id != diskid {
-			new_disk_ids[disk_counter] = disk["id"].(string)
-			disk_counter++
+	new_disk_ids := make([]string, 0, len(instance.Disks))
+	for _, disk := range instance.Disks {
+		if disk.ID != diskid {
+			new_disk_ids = append(new_disk_ids, disk.ID)
 		}
 	}
-	return InstanceUpdateDisks(api, instanceid, new_disk_ids[0:disk_counter])
+	return InstanceUpdateDisks(ctx, api, instanceid, new_disk_ids)
 }
 
-func InstanceWaitForState(api *hypercloud.ApiClient, instanceid string, desiredState string, timeout time.Duration) (err error) {
-	// Loop until correct state
-	startTime := time.Now()
-	for {
-		status, body, err := api.Instance.State(instanceid)
+// InstanceWaitForState polls until the instance is in desiredState. A zero
+// timeout waits until ctx is cancelled.
+func InstanceWaitForState(ctx context.Context, api *Client, instanceid string, desiredState string, timeout time.Duration) (err error) {
+	what := fmt.Sprintf("instance %s to be %s", instanceid, desiredState)
+	return WaitFor(ctx, pollOptions(timeout), what, func() (bool, error) {
+		body, err := api.request(idempotent, "get state of", "instance", instanceid, func() (int, map[string]interface{}, error) {
+			return api.Instance.State(instanceid)
+		})
 		if err != nil {
-			return err
+			return false, err
 		}
-		if status < 200 || status >= 300 {
-			return fmt.Errorf("error waiting for instance %s to be in state %s", instanceid, desiredState)
-		}
-		state := body["state"].(string)
-
-		if state == desiredState {
-			break
+		var state instanceState
+		if err := decode("instance state", body, &state); err != nil {
+			return false, err
 		}
-
-		if time.Now().Sub(startTime).Seconds() > timeout.Seconds() {
-			return fmt.Errorf("timeout of %s seconds exceeded while waiting for instance %s to be %s", timeout, instanceid, desiredState)
-		}
-		time.Sleep(2)
-	}
-	return nil // Successfull result, no error
+		return state.State == desiredState, nil
+	})
 }
 
-func InstanceAddDisk(api *hypercloud.ApiClient, instanceid string, diskid string) (err error) {
-	var new_disk_ids [100]string
+func InstanceAddDisk(ctx context.Context, api *Client, instanceid string, diskid string) (err error) {
 	instance, err := InstanceInfo(api, instanceid)
 	if err != nil {
 		return err
 	}
-	disks := instance["disks"].([]interface{})
-	var x int
-	for i := range disks {
-		disk := disks[i].(map[string]interface{})
-		new_disk_ids[i] = disk["id"].(string)
-		x = i
-	}
-	x++
-	new_disk_ids[x] = diskid
-	return InstanceUpdateDisks(api, instanceid, new_disk_ids[0:x+1])
+	return InstanceUpdateDisks(ctx, api, instanceid, append(instance.DiskIDs(), diskid))
 }
 
 const (
@@ -176,31 +228,25 @@ const (
 	stop  = "stop"
 )
 
-func InstanceStart(api *hypercloud.ApiClient, instanceid string, timeout uint) (err error) {
-	return startStop(api, instanceid, timeout, start)
+func InstanceStart(ctx context.Context, api *Client, instanceid string, timeout uint) (err error) {
+	return startStop(ctx, api, instanceid, timeout, start)
 }
-func InstanceStop(api *hypercloud.ApiClient, instanceid string, timeout uint) (err error) {
-	return startStop(api, instanceid, timeout, stop)
+func InstanceStop(ctx context.Context, api *Client, instanceid string, timeout uint) (err error) {
+	return startStop(ctx, api, instanceid, timeout, stop)
 }
 
-func startStop(api *hypercloud.ApiClient, instanceid string, timeout uint, action string) (err error) {
-	var status int
-	var instance map[string]interface{}
+func startStop(ctx context.Context, api *Client, instanceid string, timeout uint, action string) (err error) {
+	var fn call
 	if action == start {
-		status, instance, err = api.Instance.Start(instanceid)
+		fn = func() (int, map[string]interface{}, error) { return api.Instance.Start(instanceid) }
 	} else if action == stop {
-		status, instance, err = api.Instance.Stop(instanceid)
+		fn = func() (int, map[string]interface{}, error) { return api.Instance.Stop(instanceid) }
 	} else {
-		return fmt.Errorf("unknown action type %d", action)
+		return fmt.Errorf("unknown action type %s", action)
 	}
-	if err != nil {
+	if _, err := api.request(mutating, action, "instance", instanceid, fn); err != nil {
 		return err
 	}
-	if status < 200 || status >= 300 {
-		return fmt.Errorf("error when %s instance: %s", action, instance)
-	}
-
-	started := time.Now()
 
 	var desiredState string
 	if action == start {
@@ -208,116 +254,106 @@ func startStop(api *hypercloud.ApiClient, instanceid string, timeout uint, actio
 	} else {
 		desiredState = "stopped"
 	}
-
-	// Loop until correct state
-	for {
-		status, body, err := api.Instance.State(instanceid)
-		if err != nil {
-			return err
-		}
-		if status < 200 || status >= 300 {
-			return fmt.Errorf("error when %s instance then getting state: %s", action, body)
-		}
-		state := body["state"].(string)
-
-		if state == desiredState {
-			break
-		}
-
-		if time.Now().Sub(started).Seconds() > float64(timeout) {
-			return fmt.Errorf("timeout of %s seconds exceeded while waiting for instance %s to %s", timeout, instanceid, action)
-		}
-		time.Sleep(2)
-	}
-	return nil // Successfull result, no error
+	return InstanceWaitForState(ctx, api, instanceid, desiredState, seconds(timeout))
 }
 
 type ConsoleSession struct {
-	Host        string
-	Port        uint
-	Url         string
-	Token       string
-	ConsoleType string
-	InstanceID  string
+	ID          string `json:"id"`
+	State       string `json:"state"`
+	Host        string `json:"host"`
+	Port        uint   `json:"port"`
+	Url         string `json:"url"`
+	Token       string `json:"token"`
+	ConsoleType string `json:"type"`
+	InstanceID  string `json:"instance_id"`
 }
 
-func (session *ConsoleSession) Request(api *hypercloud.ApiClient, timeout uint) (err error) {
-	status, request, err := api.Instance.Remote_access(session.InstanceID, map[string]interface{}{"type": session.ConsoleType})
-	if err != nil {
+func (session *ConsoleSession) validate() error {
+	if err := requireFields("console session", "id", session.ID, "state", session.State); err != nil {
 		return err
 	}
-	if status < 200 || status >= 300 {
-		return fmt.Errorf("error when request console session: %s", request)
+	if session.State != "ready" {
+		return nil
+	}
+	if err := requireFields("console session", "type", session.ConsoleType, "token", session.Token); err != nil {
+		return err
+	}
+	if session.ConsoleType == "vnc" {
+		return requireFields("console session", "url", session.Url)
+	}
+	return requireFields("console session", "host", session.Host)
+}
+
+func (session *ConsoleSession) Request(ctx context.Context, api *Client, timeout uint) (err error) {
+	request, err := api.request(mutating, "request console session for", "instance", session.InstanceID, func() (int, map[string]interface{}, error) {
+		return api.Instance.Remote_access(session.InstanceID, map[string]interface{}{"type": session.ConsoleType})
+	})
+	if err != nil {
+		return err
 	}
 
-	sessionId := request["id"].(string)
-	started := time.Now()
+	var requested ConsoleSession
+	if err := decode("console session", request, &requested); err != nil {
+		return err
+	}
+	sessionId := requested.ID
 
-	// Loop until correct state
-	for {
-		status, request, err := api.ConsoleSession.Show(sessionId)
+	what := fmt.Sprintf("console session %s to become ready", sessionId)
+	return WaitFor(ctx, pollOptions(seconds(timeout)), what, func() (bool, error) {
+		request, err := api.request(idempotent, "show", "console session", sessionId, func() (int, map[string]interface{}, error) {
+			return api.ConsoleSession.Show(sessionId)
+		})
 		if err != nil {
-			return err
+			return false, err
 		}
-		if status < 200 || status >= 300 {
-			return fmt.Errorf("error when polling console session info: %s", request)
+		var polled ConsoleSession
+		if err := decode("console session", request, &polled); err != nil {
+			return false, err
 		}
-		state := request["state"].(string)
-
-		if state == "ready" {
-			session.ConsoleType = request["type"].(string)
-			session.Token = request["token"].(string)
-			if session.ConsoleType == "vnc" {
-				session.Url = request["url"].(string)
-			} else {
-				session.Host = request["host"].(string)
-				session.Port = uint(request["port"].(float64))
-			}
-			break
+		if polled.State != "ready" {
+			return false, nil
 		}
 
-		if time.Now().Sub(started).Seconds() > float64(timeout) {
-			return fmt.Errorf("timeout of %s seconds exceeded while waiting for console session %s to become ready", timeout, sessionId)
+		session.ID = polled.ID
+		session.State = polled.State
+		session.ConsoleType = polled.ConsoleType
+		session.Token = polled.Token
+		if session.ConsoleType == "vnc" {
+			session.Url = polled.Url
+		} else {
+			session.Host = polled.Host
+			session.Port = polled.Port
 		}
-		time.Sleep(2)
-	}
-	return nil // Successfull result, no error
+		return true, nil
+	})
 }
 
-func InstanceRemoveNetworks(api *hypercloud.ApiClient, instanceid string) (err error) {
-	status, body, err := api.Instance.Update_networking(instanceid, map[string]interface{}{
-		"network_adapters": make([]map[string]interface{}, 0),
+func InstanceRemoveNetworks(api *Client, instanceid string) (err error) {
+	_, err = api.requestArray(idempotent, "remove networks from", "instance", instanceid, func() (int, []map[string]interface{}, error) {
+		return api.Instance.Update_networking(instanceid, map[string]interface{}{
+			"network_adapters": make([]map[string]interface{}, 0),
+		})
 	})
-	if err != nil {
-		return err
-	}
-	if status < 200 || status >= 300 {
-		return fmt.Errorf("error when removing ips: %d: %s", status, body)
-	}
-	return nil
+	return err
 }
 
-func InstanceTerminate(api *hypercloud.ApiClient, instanceid string, timeout uint, wait bool) (err error) {
-	status, body, err := api.Instance.Delete(instanceid)
+func InstanceTerminate(ctx context.Context, api *Client, instanceid string, timeout uint, wait bool) (err error) {
+	_, err = api.request(deleting, "delete", "instance", instanceid, func() (int, map[string]interface{}, error) {
+		return api.Instance.Delete(instanceid)
+	})
 	if err != nil {
 		return err
 	}
-	if status < 200 || status >= 300 {
-		return fmt.Errorf("error when deleting instance: %d: %s", status, body)
-	}
 
-	if wait {
-		for {
-			instance, err := InstanceInfo(api, instanceid)
-			if err != nil {
-				return err
-			}
-			state := instance["state"].(string)
-			if state == "terminated" {
-				break
-			}
-			time.Sleep(2)
-		}
+	if !wait {
+		return nil
 	}
-	return nil
+	what := fmt.Sprintf("instance %s to terminate", instanceid)
+	return WaitFor(ctx, pollOptions(seconds(timeout)), what, func() (bool, error) {
+		instance, err := InstanceInfo(api, instanceid)
+		if err != nil {
+			return false, err
+		}
+		return instance.State == "terminated", nil
+	})
 }
@@ -0,0 +1,118 @@
+package api_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/thehypercloud/packer-hypercloud/api"
+	"github.com/thehypercloud/packer-hypercloud/api/hypercloudtest"
+)
+
+func TestCreateDiskWaitsUntilReady(t *testing.T) {
+	srv := hypercloudtest.NewServer()
+	defer srv.Close()
+	f := srv.Seed()
+
+	disk, err := api.CreateBlankDisk(context.Background(), srv.Client(), 10, "blank", f.RegionID, f.DiskTierID, api.Tags{"a": "b"})
+	if err != nil {
+		t.Fatalf("CreateBlankDisk: %s", err)
+	}
+	if disk.State != "unattached" || disk.Size != 10 || disk.Tags["a"] != "b" {
+		t.Errorf("got %+v, expected an unattached 10 GB disk tagged a=b", disk)
+	}
+}
+
+func TestCopyDiskClones(t *testing.T) {
+	srv := hypercloudtest.NewServer()
+	defer srv.Close()
+	f := srv.Seed()
+	source := srv.AddDisk(f.RegionID, "finished", 10)
+	otherRegion := srv.AddRegion("Other")
+	otherTier := srv.AddDiskTier(otherRegion, "Standard")
+
+	disk, err := api.CopyDisk(context.Background(), srv.Client(), source, "copy", otherRegion, otherTier, api.Tags{"a": "b"})
+	if err != nil {
+		t.Fatalf("CopyDisk: %s", err)
+	}
+	if disk.State != "unattached" || disk.Size != 10 || disk.Region.ID != otherRegion || disk.Tags["a"] != "b" {
+		t.Errorf("got %+v, expected an unattached 10 GB disk in %s tagged a=b", disk, otherRegion)
+	}
+	if countRequests(srv, "POST "+hypercloudtest.APIPrefix+"disks/"+source+"/clone") != 1 {
+		t.Errorf("expected the disk to be cloned, got requests %v", srv.Requests())
+	}
+}
+
+func TestStartAndStopInstance(t *testing.T) {
+	srv := hypercloudtest.NewServer()
+	defer srv.Close()
+	f := srv.Seed()
+	ctx := context.Background()
+	client := srv.Client()
+
+	if err := api.InstanceStart(ctx, client, f.DownloaderID, api.DEFAULT_TIMEOUT); err != nil {
+		t.Fatalf("InstanceStart: %s", err)
+	}
+	if instance, _ := srv.Instance(f.DownloaderID); instance.State != "running" {
+		t.Errorf("instance is %s after starting, expected running", instance.State)
+	}
+	if err := api.InstanceStart(ctx, client, f.DownloaderID, api.DEFAULT_TIMEOUT); !api.IsConflict(err) {
+		t.Errorf("starting a running instance returned %v, expected a 409", err)
+	}
+	if err := api.InstanceStop(ctx, client, f.DownloaderID, api.DEFAULT_TIMEOUT); err != nil {
+		t.Fatalf("InstanceStop: %s", err)
+	}
+	if instance, _ := srv.Instance(f.DownloaderID); instance.State != "stopped" {
+		t.Errorf("instance is %s after stopping, expected stopped", instance.State)
+	}
+}
+
+func TestLiveAttachAndDetach(t *testing.T) {
+	srv := hypercloudtest.NewServer()
+	defer srv.Close()
+	f := srv.Seed()
+	ctx := context.Background()
+	client := srv.Client()
+
+	diskID := srv.AddDisk(f.RegionID, "data", 10)
+	if err := api.InstanceStart(ctx, client, f.DownloaderID, api.DEFAULT_TIMEOUT); err != nil {
+		t.Fatalf("InstanceStart: %s", err)
+	}
+
+	// Settling takes a second poll, so the attach must be waited for
+	srv.Polls = 2
+	if err := api.InstanceAddDisk(ctx, client, f.DownloaderID, diskID); err != nil {
+		t.Fatalf("InstanceAddDisk: %s", err)
+	}
+	disk, _ := srv.Disk(diskID)
+	if disk.State != "attached" || disk.InstanceID != f.DownloaderID {
+		t.Errorf("disk is %s on instance %q after attaching, expected attached to %s", disk.State, disk.InstanceID, f.DownloaderID)
+	}
+
+	if err := api.InstanceRemoveDisk(ctx, client, f.DownloaderID, diskID); err != nil {
+		t.Fatalf("InstanceRemoveDisk: %s", err)
+	}
+	disk, _ = srv.Disk(diskID)
+	if disk.State != "unattached" || disk.InstanceID != "" {
+		t.Errorf("disk is %s on instance %q after detaching, expected unattached", disk.State, disk.InstanceID)
+	}
+	instance, _ := srv.Instance(f.DownloaderID)
+	if ids := instance.DiskIDs(); len(ids) != 1 || ids[0] != f.DownloaderDiskID {
+		t.Errorf("instance has disks %v, expected only its own", ids)
+	}
+}
+
+func TestTerminateReleasesDisksAndIPs(t *testing.T) {
+	srv := hypercloudtest.NewServer()
+	defer srv.Close()
+	f := srv.Seed()
+
+	if err := api.InstanceTerminate(context.Background(), srv.Client(), f.DownloaderID, api.DEFAULT_TIMEOUT, true); err != nil {
+		t.Fatalf("InstanceTerminate: %s", err)
+	}
+	if instance, _ := srv.Instance(f.DownloaderID); instance.State != "terminated" {
+		t.Errorf("instance is %s, expected terminated", instance.State)
+	}
+	if disk, _ := srv.Disk(f.DownloaderDiskID); disk.State != "unattached" {
+		t.Errorf("its disk is %s, expected unattached", disk.State)
+	}
+}
@@ -1,47 +1,156 @@
 package api
 
 import (
-	"errors"
 	"fmt"
-
-	"github.com/thehypercloud/apiclient-go"
+	"net"
+	"strings"
 )
 
-func NetworkInfo(api *hypercloud.ApiClient, id string) (info map[string]interface{}, err error) {
-	status, info, error := api.Network.Show(id)
-	if error != nil {
-		return nil, error
+type Network struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Netmask       string `json:"netmask"`
+	Gateway       string `json:"gateway"`
+	Specification string `json:"specification"`
+	Region        Region `json:"region"`
+}
+
+func (n *Network) validate() error {
+	return requireFields("network", "id", n.ID)
+}
+
+// PrefixLength returns the CIDR prefix length from the network
+// specification, e.g. "24" for "10.0.0.0/24"
+func (n *Network) PrefixLength() (string, error) {
+	parts := strings.Split(n.Specification, "/")
+	if len(parts) != 2 || parts[1] == "" {
+		return "", fmt.Errorf("network %s has an invalid specification %q", n.ID, n.Specification)
+	}
+	return parts[1], nil
+}
+
+// HostCount returns the number of addresses in the network that can be
+// allocated, i.e. all but the network, broadcast and gateway addresses
+func (n *Network) HostCount() (int, error) {
+	_, subnet, err := net.ParseCIDR(n.Specification)
+	if err != nil {
+		return 0, fmt.Errorf("network %s has an invalid specification %q", n.ID, n.Specification)
+	}
+	ones, bits := subnet.Mask.Size()
+	if bits-ones > 30 {
+		return 1 << 30, nil
+	}
+	count := 1<<uint(bits-ones) - 2
+	if n.Gateway != "" {
+		count--
 	}
-	if status < 200 || status >= 300 {
-		return info, errors.New(fmt.Sprint(status))
+	if count < 0 {
+		count = 0
 	}
-	return info, nil
+	return count, nil
 }
 
-func AllocateIP(api *hypercloud.ApiClient, networkid string, ipname string) (ip map[string]interface{}, err error) {
-	args := map[string]interface{}{
-		"network": networkid,
+type IPAddress struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Address    string    `json:"address"`
+	InstanceID string    `json:"instance_id"`
+	Network    string    `json:"network"`
+	Tags       Tags      `json:"tags"`
+	CreatedAt  Timestamp `json:"created_at"`
+}
+
+func (ip *IPAddress) validate() error {
+	return requireFields("ip address", "id", ip.ID, "address", ip.Address)
+}
+
+func ListNetworks(api *Client) (networks []Network, err error) {
+	raw, err := api.requestList("list", "networks", func() (int, []map[string]interface{}, error) {
+		return api.Network.List()
+	})
+	if err != nil {
+		return nil, err
+	}
+	networks = make([]Network, len(raw))
+	for i := range raw {
+		if err := decode("network", raw[i], &networks[i]); err != nil {
+			return nil, err
+		}
+	}
+	return networks, nil
+}
+
+// FindNetworkByName returns the network with a name, in the region if one
+// is given
+func FindNetworkByName(api *Client, name string, region string) (*Network, error) {
+	networks, err := ListNetworks(api)
+	if err != nil {
+		return nil, err
 	}
+	candidates := make([]named, len(networks))
+	for i, n := range networks {
+		candidates[i] = named{ID: n.ID, Name: n.Name, Region: n.Region}
+	}
+	i, err := matchName("network", candidates, name, region)
+	if err != nil {
+		return nil, err
+	}
+	return &networks[i], nil
+}
+
+func NetworkInfo(api *Client, id string) (network *Network, err error) {
+	info, err := api.request(idempotent, "show", "network", id, func() (int, map[string]interface{}, error) {
+		return api.Network.Show(id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	network = new(Network)
+	if err := decode("network", info, network); err != nil {
+		return nil, err
+	}
+	return network, nil
+}
+
+func AllocateIP(api *Client, networkid string, ipname string, tags Tags) (ip *IPAddress, err error) {
+	args := tags.addTo(map[string]interface{}{
+		"network": networkid,
+	})
 	if ipname != "" {
 		args["name"] = ipname
 	}
-	status, result, err := api.IpAddress.Allocate(args)
+	result, err := api.request(mutating, "allocate", "ip address", "", func() (int, map[string]interface{}, error) {
+		return api.IpAddress.Allocate(args)
+	})
 	if err != nil {
 		return nil, err
 	}
-	if status < 200 || status >= 300 {
-		return result, errors.New(fmt.Sprint(status))
+	ip = new(IPAddress)
+	if err := decode("ip address", result, ip); err != nil {
+		return nil, err
 	}
-	return result, nil
+	return ip, nil
 }
 
-func DeallocateIP(api *hypercloud.ApiClient, ipId string) (err error) {
-	status, _, err := api.IpAddress.Deallocate(ipId)
+func IPAddressList(api *Client) (ips []IPAddress, err error) {
+	raw, err := api.requestList("list", "ip addresses", func() (int, []map[string]interface{}, error) {
+		return api.IpAddress.List()
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if status < 200 || status >= 300 {
-		return errors.New(fmt.Sprint(status))
+	ips = make([]IPAddress, len(raw))
+	for i := range raw {
+		if err := decode("ip address", raw[i], &ips[i]); err != nil {
+			return nil, err
+		}
 	}
-	return nil
+	return ips, nil
+}
+
+func DeallocateIP(api *Client, ipId string) (err error) {
+	_, err = api.request(deleting, "deallocate", "ip address", ipId, func() (int, map[string]interface{}, error) {
+		return api.IpAddress.Deallocate(ipId)
+	})
+	return err
 }
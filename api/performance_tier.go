@@ -1,25 +1,85 @@
 package api
 
 import (
-	"errors"
 	"fmt"
-	"github.com/thehypercloud/apiclient-go"
 )
 
-func FindDiskTier(api *hypercloud.ApiClient, id string) (info map[string]interface{}, err error) {
-	status, tiers, error := api.PerformanceTier.List_disk()
-	if error != nil {
-		return nil, error
+type PerformanceTier struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Region Region `json:"region"`
+}
+
+func (t *PerformanceTier) validate() error {
+	if err := requireFields("performance tier", "id", t.ID); err != nil {
+		return err
 	}
-	if status < 200 || status >= 300 {
-		return info, errors.New(fmt.Sprint(status))
+	return t.Region.validate()
+}
+
+func ListDiskTiers(api *Client) ([]PerformanceTier, error) {
+	return listTiers(api, "disk", api.PerformanceTier.List_disk)
+}
+
+func ListInstanceTiers(api *Client) ([]PerformanceTier, error) {
+	return listTiers(api, "instance", api.PerformanceTier.List_instance)
+}
+
+func listTiers(api *Client, kind string, list listCall) (tiers []PerformanceTier, err error) {
+	raw, err := api.requestList("list", kind+" performance tiers", list)
+	if err != nil {
+		return nil, err
 	}
+	tiers = make([]PerformanceTier, len(raw))
+	for i := range raw {
+		if err := decode(kind+" performance tier", raw[i], &tiers[i]); err != nil {
+			return nil, err
+		}
+	}
+	return tiers, nil
+}
 
+func FindDiskTier(api *Client, id string) (tier *PerformanceTier, err error) {
+	tiers, err := ListDiskTiers(api)
+	if err != nil {
+		return nil, err
+	}
 	for i := range tiers {
-		tier := tiers[i]
-		if tier["id"] == id {
-			return tier, nil
+		if tiers[i].ID == id {
+			return &tiers[i], nil
 		}
 	}
 	return nil, fmt.Errorf("No disk tier with id %s was found", id)
 }
+
+// FindDiskTierByName returns the disk performance tier with a name, in
+// the region if one is given
+func FindDiskTierByName(api *Client, name string, region string) (*PerformanceTier, error) {
+	tiers, err := ListDiskTiers(api)
+	if err != nil {
+		return nil, err
+	}
+	return matchTier("disk performance tier", tiers, name, region)
+}
+
+// FindInstanceTierByName returns the instance performance tier with a
+// name, in the region if one is given
+func FindInstanceTierByName(api *Client, name string, region string) (*PerformanceTier, error) {
+	tiers, err := ListInstanceTiers(api)
+	if err != nil {
+		return nil, err
+	}
+	return matchTier("instance performance tier", tiers, name, region)
+}
+
+func matchTier(kind string, tiers []PerformanceTier, name string, region string) (*PerformanceTier, error) {
+	candidates := make([]named, len(tiers))
+	for i, t := range tiers {
+		candidates[i] = named{ID: t.ID, Name: t.Name, Region: t.Region}
+	}
+	i, err := matchName(kind, candidates, name, region)
+	if err != nil {
+		return nil, err
+	}
+	return &tiers[i], nil
+}
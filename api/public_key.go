@@ -1,34 +1,45 @@
 package api
 
-import (
-	"errors"
-	"fmt"
-	"github.com/thehypercloud/apiclient-go"
-)
+type PublicKey struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
 
-func ListPublicKeys(api *hypercloud.ApiClient) (data []map[string]interface{}, err error) {
-	status, data, error := api.PublicKey.List()
-	if error != nil {
-		return nil, error
-	}
-	if status < 200 || status >= 300 {
-		return data, errors.New(fmt.Sprint(status))
+func (k *PublicKey) validate() error {
+	return requireFields("public key", "id", k.ID)
+}
+
+func ListPublicKeys(api *Client) (keys []PublicKey, err error) {
+	data, err := api.requestList("list", "public keys", func() (int, []map[string]interface{}, error) {
+		return api.PublicKey.List()
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return data, nil
+	keys = make([]PublicKey, len(data))
+	for i := range data {
+		if err := decode("public key", data[i], &keys[i]); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
 }
 
-func PublicKeyCreate(api *hypercloud.ApiClient, name string, keyData string) (map[string]interface{}, error) {
-	status, result, err := api.PublicKey.Create(map[string]interface{}{
-		"key": keyData,
-		"name": name,
+func PublicKeyCreate(api *Client, name string, keyData string) (*PublicKey, error) {
+	result, err := api.request(mutating, "create", "public key", "", func() (int, map[string]interface{}, error) {
+		return api.PublicKey.Create(map[string]interface{}{
+			"key":  keyData,
+			"name": name,
+		})
 	})
-
 	if err != nil {
 		return nil, err
 	}
-	if status < 200 || status >= 300 {
-		return result, fmt.Errorf("%d : %s", status, result)
+	key := new(PublicKey)
+	if err := decode("public key", result, key); err != nil {
+		return nil, err
 	}
-	return result, nil
+	return key, nil
 }
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Region is the summary of a region embedded in tiers, disks and templates
+type Region struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func (r *Region) validate() error {
+	return requireFields("region", "id", r.ID)
+}
+
+func ListRegions(api *Client) (regions []Region, err error) {
+	raw, err := api.requestList("list", "regions", func() (int, []map[string]interface{}, error) {
+		return api.Region.List()
+	})
+	if err != nil {
+		return nil, err
+	}
+	regions = make([]Region, len(raw))
+	for i := range raw {
+		if err := decode("region", raw[i], &regions[i]); err != nil {
+			return nil, err
+		}
+	}
+	return regions, nil
+}
+
+// FindRegion returns the region with an id or name
+func FindRegion(api *Client, region string) (*Region, error) {
+	regions, err := ListRegions(api)
+	if err != nil {
+		return nil, err
+	}
+	for i := range regions {
+		if regions[i].ID == region {
+			return &regions[i], nil
+		}
+	}
+	candidates := make([]named, len(regions))
+	for i, r := range regions {
+		candidates[i] = named{ID: r.ID, Name: r.Name}
+	}
+	i, err := matchName("region", candidates, region, "")
+	if err != nil {
+		return nil, err
+	}
+	return &regions[i], nil
+}
+
+// named is a resource that can be looked up by name
+type named struct {
+	ID     string
+	Name   string
+	Region Region
+}
+
+// matchName returns the index of the one candidate with a name, in the
+// region if one is given. The error lists the names to choose from when
+// none match, or the ids to choose between when several do.
+func matchName(kind string, candidates []named, name string, region string) (int, error) {
+	var matches []int
+	available := make(map[string]bool)
+	for i, c := range candidates {
+		if region != "" && c.Region.ID != "" && c.Region.ID != region {
+			continue
+		}
+		available[c.Name] = true
+		if c.Name == name {
+			matches = append(matches, i)
+		}
+	}
+
+	in := ""
+	if region != "" {
+		in = " in region " + region
+	}
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		names := make([]string, 0, len(available))
+		for n := range available {
+			names = append(names, fmt.Sprintf("%q", n))
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return -1, fmt.Errorf("No %s named %q was found%s: there are none", kind, name, in)
+		}
+		return -1, fmt.Errorf("No %s named %q was found%s. Available: %s", kind, name, in, strings.Join(names, ", "))
+	}
+	ids := make([]string, len(matches))
+	for i, m := range matches {
+		c := candidates[m]
+		ids[i] = c.ID
+		if c.Region.ID != "" {
+			ids[i] += " (region " + c.Region.Name + ")"
+		}
+	}
+	return -1, fmt.Errorf("%d %ss are named %q%s, use an id instead or narrow it down with region: %s",
+		len(matches), kind, name, in, strings.Join(ids, ", "))
+}
@@ -0,0 +1,27 @@
+package api
+
+// Tags are key/value metadata attached to a resource, e.g. to attribute its
+// cost to the build that created it
+type Tags map[string]string
+
+// Merge returns a copy of t with the tags from other added, replacing any
+// with the same key
+func (t Tags) Merge(other Tags) Tags {
+	merged := make(Tags, len(t)+len(other))
+	for k, v := range t {
+		merged[k] = v
+	}
+	for k, v := range other {
+		merged[k] = v
+	}
+	return merged
+}
+
+// addTo sets the tags in the parameters of a create or update call, unless
+// there are none
+func (t Tags) addTo(params map[string]interface{}) map[string]interface{} {
+	if len(t) > 0 {
+		params["tags"] = map[string]string(t)
+	}
+	return params
+}
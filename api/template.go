@@ -1,19 +1,168 @@
 package api
 
 import (
-	"errors"
 	"fmt"
-	"github.com/thehypercloud/apiclient-go"
+	"sort"
 )
 
-func ListTemplates(api *hypercloud.ApiClient) (templates []map[string]interface{}, err error) {
-	status, templates, error := api.Template.List()
-	if error != nil {
-		return nil, error
+type Template struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	Version   int       `json:"version"`
+	Size      uint      `json:"size"` // of its disk in GB, 0 if not known
+	Region    Region    `json:"region"`
+	Tags      Tags      `json:"tags"`
+	CreatedAt Timestamp `json:"created_at"`
+}
+
+func (t *Template) validate() error {
+	if err := requireFields("template", "id", t.ID); err != nil {
+		return err
 	}
-	if status < 200 || status >= 300 {
-		return templates, errors.New(fmt.Sprint(status))
+	return t.Region.validate()
+}
+
+func ListTemplates(api *Client) (templates []Template, err error) {
+	raw, err := api.requestList("list", "templates", func() (int, []map[string]interface{}, error) {
+		return api.Template.List()
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	templates = make([]Template, len(raw))
+	for i := range raw {
+		if err := decode("template", raw[i], &templates[i]); err != nil {
+			return nil, err
+		}
+	}
 	return templates, nil
 }
+
+// ByVersionDesc sorts templates newest version first
+type ByVersionDesc []Template
+
+func (s ByVersionDesc) Len() int {
+	return len(s)
+}
+func (s ByVersionDesc) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s ByVersionDesc) Less(i, j int) bool {
+	return s[i].Version > s[j].Version
+}
+
+// NextTemplateVersion returns the version a new template in region should
+// have to supersede the newest existing template with the same slug, or if
+// slug is empty the same name. The first version is 1.
+func NextTemplateVersion(templates []Template, region string, name string, slug string) int {
+	sorted := make([]Template, len(templates))
+	copy(sorted, templates)
+	sort.Sort(ByVersionDesc(sorted))
+	for _, t := range sorted {
+		if t.Region.ID != region {
+			continue
+		}
+		if (slug != "" && t.Slug == slug) || (slug == "" && t.Name == name) {
+			return t.Version + 1
+		}
+	}
+	return 1
+}
+
+// templateCreateAttempts bounds how many versions TemplateCreate tries
+// when other builds are publishing the same template at once
+const templateCreateAttempts = 5
+
+// TemplateCreate publishes a disk as a template at the next version after
+// any existing template with the same slug or name.
+//
+// The version is worked out from the templates listed beforehand, so builds
+// publishing the same template at once can choose the same version. Each
+// lists the templates again after creating its own, and where versions
+// clash the template with the greater ID is deleted and created again at a
+// later version, leaving one template per version. A template that the
+// listing doesn't show yet can't be detected, so the race is narrowed
+// rather than closed.
+func TemplateCreate(api *Client, diskid string, region string, name string, slug string, tags Tags) (*Template, error) {
+	for attempt := 1; ; attempt++ {
+		templates, err := ListTemplates(api)
+		if err != nil {
+			return nil, err
+		}
+		version := NextTemplateVersion(templates, region, name, slug)
+
+		template, err := templateCreate(api, diskid, name, slug, version, tags)
+		if IsConflict(err) && attempt < templateCreateAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		templates, err = ListTemplates(api)
+		if err != nil {
+			return nil, err
+		}
+		if !templateVersionClash(template, templates, region, name, slug) {
+			return template, nil
+		}
+		if err := TemplateDelete(api, template.ID); err != nil {
+			return nil, err
+		}
+		if attempt == templateCreateAttempts {
+			return nil, fmt.Errorf("template %s version %d was published by another build at the same time; gave up after %d attempts", name, version, attempt)
+		}
+	}
+}
+
+// templateCreate creates a template from a disk. The apiclient has no call
+// for this, so the request is sent with MapRequest.
+func templateCreate(api *Client, diskid string, name string, slug string, version int, tags Tags) (*Template, error) {
+	args := tags.addTo(map[string]interface{}{
+		"disk":    diskid,
+		"name":    name,
+		"version": version,
+	})
+	if slug != "" {
+		args["slug"] = slug
+	}
+	result, err := api.request(mutating, "create", "template", "", func() (int, map[string]interface{}, error) {
+		return api.MapRequest(apiPath+"/templates", "POST", args)
+	})
+	if err != nil {
+		return nil, err
+	}
+	template := new(Template)
+	if err := decode("template", result, template); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// templateVersionClash reports whether another template with the same slug
+// or name has template's version, and takes precedence over it by having
+// the lesser ID
+func templateVersionClash(template *Template, templates []Template, region string, name string, slug string) bool {
+	for _, t := range templates {
+		if t.ID == template.ID || t.Region.ID != region || t.Version != template.Version {
+			continue
+		}
+		if (slug != "" && t.Slug == slug) || (slug == "" && t.Name == name) {
+			if t.ID < template.ID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TemplateDelete deletes a template. Like templateCreate it sends the
+// request itself, as the apiclient only shows and lists templates.
+func TemplateDelete(api *Client, id string) error {
+	_, err := api.request(deleting, "delete", "template", id, func() (int, map[string]interface{}, error) {
+		return api.MapRequest(apiPath+"/templates/"+id, "DELETE", nil)
+	})
+	return err
+}
@@ -0,0 +1,35 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/thehypercloud/packer-hypercloud/api"
+	"github.com/thehypercloud/packer-hypercloud/api/hypercloudtest"
+)
+
+func TestTemplateCreate(t *testing.T) {
+	srv := hypercloudtest.NewServer()
+	defer srv.Close()
+	f := srv.Seed()
+	client := srv.Client()
+	diskID := srv.AddDisk(f.RegionID, "finished", 10)
+
+	template, err := api.TemplateCreate(client, diskID, f.RegionID, "Ubuntu 16.04", "ubuntu-16.04", nil)
+	if err != nil {
+		t.Fatalf("TemplateCreate: %s", err)
+	}
+	if template.Version != 2 {
+		t.Errorf("published version %d, expected 2 after the seeded version 1", template.Version)
+	}
+
+	// A version taken since the templates were listed is tried again
+	srv.Fail("POST", "templates", http.StatusConflict, 1)
+	template, err = api.TemplateCreate(client, diskID, f.RegionID, "Ubuntu 16.04", "ubuntu-16.04", nil)
+	if err != nil {
+		t.Fatalf("TemplateCreate after a conflict: %s", err)
+	}
+	if template.Version != 3 {
+		t.Errorf("published version %d, expected 3", template.Version)
+	}
+}
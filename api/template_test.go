@@ -0,0 +1,53 @@
+package api
+
+import "testing"
+
+func TestNextTemplateVersion(t *testing.T) {
+	templates := []Template{
+		{ID: "t1", Name: "Ubuntu", Slug: "ubuntu", Version: 1, Region: Region{ID: "r1"}},
+		{ID: "t2", Name: "Ubuntu", Slug: "ubuntu", Version: 3, Region: Region{ID: "r1"}},
+		{ID: "t3", Name: "Ubuntu", Slug: "ubuntu", Version: 7, Region: Region{ID: "r2"}},
+		{ID: "t4", Name: "Ubuntu", Version: 2, Region: Region{ID: "r1"}},
+		{ID: "t5", Name: "Debian", Slug: "debian", Version: 4, Region: Region{ID: "r1"}},
+	}
+	for _, tc := range []struct {
+		region, name, slug string
+		want               int
+	}{
+		{"r1", "Ubuntu", "ubuntu", 4},
+		{"r2", "Ubuntu", "ubuntu", 8},
+		// Without a slug, matched by name whatever their slugs
+		{"r1", "Ubuntu", "", 4},
+		{"r1", "Debian", "", 5},
+		// A slug is matched regardless of name
+		{"r1", "Renamed", "debian", 5},
+		{"r1", "New", "new", 1},
+		{"r3", "Ubuntu", "ubuntu", 1},
+	} {
+		if got := NextTemplateVersion(templates, tc.region, tc.name, tc.slug); got != tc.want {
+			t.Errorf("NextTemplateVersion(%s, %s, %q) = %d, expected %d", tc.region, tc.name, tc.slug, got, tc.want)
+		}
+	}
+}
+
+func TestTemplateVersionClash(t *testing.T) {
+	ours := &Template{ID: "t5", Name: "Ubuntu", Slug: "ubuntu", Version: 2, Region: Region{ID: "r1"}}
+	for _, tc := range []struct {
+		name  string
+		other Template
+		slug  string
+		want  bool
+	}{
+		{"earlier build took the version", Template{ID: "t4", Name: "Ubuntu", Slug: "ubuntu", Version: 2, Region: Region{ID: "r1"}}, "ubuntu", true},
+		{"later build took the version", Template{ID: "t6", Name: "Ubuntu", Slug: "ubuntu", Version: 2, Region: Region{ID: "r1"}}, "ubuntu", false},
+		{"different version", Template{ID: "t4", Name: "Ubuntu", Slug: "ubuntu", Version: 1, Region: Region{ID: "r1"}}, "ubuntu", false},
+		{"different region", Template{ID: "t4", Name: "Ubuntu", Slug: "ubuntu", Version: 2, Region: Region{ID: "r2"}}, "ubuntu", false},
+		{"different slug", Template{ID: "t4", Name: "Ubuntu", Slug: "other", Version: 2, Region: Region{ID: "r1"}}, "ubuntu", false},
+		{"same name without slug", Template{ID: "t4", Name: "Ubuntu", Version: 2, Region: Region{ID: "r1"}}, "", true},
+	} {
+		templates := []Template{*ours, tc.other}
+		if got := templateVersionClash(ours, templates, "r1", "Ubuntu", tc.slug); got != tc.want {
+			t.Errorf("%s: got %v, expected %v", tc.name, got, tc.want)
+		}
+	}
+}
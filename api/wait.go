@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// WaitOptions controls how often WaitFor polls and for how long
+type WaitOptions struct {
+	Interval    time.Duration // delay between the first checks, defaults to 2s
+	MaxInterval time.Duration // upper bound on the delay as it backs off
+	Backoff     float64       // factor the delay grows by after each check, 1 if unset
+	Timeout     time.Duration // overall deadline, zero waits until ctx is done
+}
+
+// pollOptions are the options used by the wait loops in this package
+func pollOptions(timeout time.Duration) WaitOptions {
+	return WaitOptions{
+		Interval:    2 * time.Second,
+		MaxInterval: 10 * time.Second,
+		Backoff:     1.5,
+		Timeout:     timeout,
+	}
+}
+
+func seconds(timeout uint) time.Duration {
+	return time.Duration(timeout) * time.Second
+}
+
+// WaitFor calls check until it reports done or returns an error, sleeping
+// between calls as described by opts. It gives up when opts.Timeout has
+// passed or ctx is cancelled. What describes the condition being waited
+// for, and is used in the returned error. On cancellation the error wraps
+// ctx.Err(), so errors.Is tells an interrupt apart from a timeout.
+func WaitFor(ctx context.Context, opts WaitOptions, what string, check func() (bool, error)) error {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+
+	var deadline <-chan time.Time
+	if opts.Timeout > 0 {
+		timer := time.NewTimer(opts.Timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		done, err := check()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		sleep := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			sleep.Stop()
+			return fmt.Errorf("cancelled while waiting for %s: %w", what, ctx.Err())
+		case <-deadline:
+			sleep.Stop()
+			return fmt.Errorf("timeout of %s exceeded while waiting for %s", opts.Timeout, what)
+		case <-sleep.C:
+		}
+
+		if opts.Backoff > 1 {
+			interval = time.Duration(float64(interval) * opts.Backoff)
+			if opts.MaxInterval > 0 && interval > opts.MaxInterval {
+				interval = opts.MaxInterval
+			}
+		}
+	}
+}
+
+// Sleep pauses for d, returning early with an error wrapping ctx.Err() if
+// ctx is cancelled
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("cancelled while sleeping for %s: %w", d, ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
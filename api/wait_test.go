@@ -0,0 +1,88 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thehypercloud/packer-hypercloud/api"
+	"github.com/thehypercloud/packer-hypercloud/api/hypercloudtest"
+)
+
+var fastPoll = api.WaitOptions{Interval: time.Millisecond}
+
+func TestWaitForDone(t *testing.T) {
+	checks := 0
+	err := api.WaitFor(context.Background(), fastPoll, "three checks", func() (bool, error) {
+		checks++
+		return checks == 3, nil
+	})
+	if err != nil || checks != 3 {
+		t.Errorf("got %v after %d checks, expected success after 3", err, checks)
+	}
+}
+
+func TestWaitForCheckError(t *testing.T) {
+	failed := errors.New("failed")
+	err := api.WaitFor(context.Background(), fastPoll, "a failure", func() (bool, error) {
+		return false, failed
+	})
+	if err != failed {
+		t.Errorf("got %v, expected the check's error", err)
+	}
+}
+
+func TestWaitForCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	checks := 0
+	err := api.WaitFor(ctx, fastPoll, "cancellation", func() (bool, error) {
+		checks++
+		if checks == 2 {
+			cancel()
+		}
+		return false, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, expected it to wrap context.Canceled", err)
+	}
+	if !strings.Contains(err.Error(), "cancellation") {
+		t.Errorf("got %q, expected it to say what was being waited for", err)
+	}
+}
+
+func TestWaitForTimeout(t *testing.T) {
+	opts := api.WaitOptions{Interval: time.Millisecond, Timeout: 20 * time.Millisecond}
+	err := api.WaitFor(context.Background(), opts, "nothing", func() (bool, error) {
+		return false, nil
+	})
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, expected a timeout that doesn't wrap a context error", err)
+	}
+}
+
+func TestSleepCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := api.Sleep(ctx, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, expected it to wrap context.Canceled", err)
+	}
+}
+
+func TestInstanceWaitCancelled(t *testing.T) {
+	srv := hypercloudtest.NewServer()
+	defer srv.Close()
+	f := srv.Seed()
+	srv.Polls = 1000
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	err := api.InstanceStart(ctx, srv.Client(), f.DownloaderID, api.DEFAULT_TIMEOUT)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, expected it to wrap context.Canceled", err)
+	}
+}
@@ -1,206 +1,195 @@
 package clone
 
 import (
-	"errors"
+	"context"
 	"fmt"
-	"log"
-	"time"
-
-	"github.com/mitchellh/multistep"
-	"github.com/hashicorp/packer/common"
-	"github.com/hashicorp/packer/helper/communicator"
-	"github.com/hashicorp/packer/helper/config"
-	"github.com/hashicorp/packer/packer"
-	"github.com/hashicorp/packer/template/interpolate"
-	"github.com/thehypercloud/apiclient-go"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	"github.com/hashicorp/packer-plugin-sdk/communicator"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
 	"github.com/thehypercloud/packer-hypercloud/api"
+	hccommon "github.com/thehypercloud/packer-hypercloud/builder/hypercloud/common"
 )
 
 type Builder struct {
 	config Config
-	runner multistep.Runner
 }
 
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+
 type Config struct {
-	common.PackerConfig `mapstructure:",squash"`
-	Comm                communicator.Config `mapstructure:",squash"`
-
-	TemplateID                string `mapstructure:"template_id"`
-	TemplateName              string `mapstructure:"template_name"`
-	TemplateSlug			  string `mapstructure:"template_slug"`
-	DiskPerformanceTierID     string `mapstructure:"disk_performance_tier_id"`
-	InstancePerformanceTierID string `mapstructure:"instance_performance_tier_id"`
-	DiskSize                  uint   `mapstructure:"disk_size"`
-	NetworkID                 string `mapstructure:"network_id"`
-	Memory                    uint   `mapstructure:"memory"`
-	HYPERCLOUD_ID             string `mapstructure:"hypercloud_id"`
-	HYPERCLOUD_SECRET         string `mapstructure:"hypercloud_secret"`
-	HYPERCLOUD_URL            string `mapstructure:"hypercloud_url"`
-	HYPERCLOUD_ACCESS_TOKEN   string `mapstructure:"hypercloud_access_token"`
-	ShutdownFromAPI           bool   `mapstructure:"shutdown_from_api"`
-
-	regionId       string
+	common.PackerConfig         `mapstructure:",squash"`
+	Comm                        communicator.Config `mapstructure:",squash"`
+	hccommon.TagConfig          `mapstructure:",squash"`
+	hccommon.ArtifactNameConfig `mapstructure:",squash"`
+	hccommon.PublishConfig      `mapstructure:",squash"`
+	hccommon.LocationConfig     `mapstructure:",squash"`
+	hccommon.PreflightConfig    `mapstructure:",squash"`
+	hccommon.AccessConfig       `mapstructure:",squash"`
+	hccommon.RunConfig          `mapstructure:",squash"`
+
+	TemplateID   string `mapstructure:"template_id"`
+	TemplateName string `mapstructure:"template_name"`
+	TemplateSlug string `mapstructure:"template_slug"`
+
 	virtualization string
 
 	ctx interpolate.Context
 }
 
-func (self *Builder) Prepare(raws ...interface{}) (params []string, retErr error) {
+func (c *Config) templateSource() hccommon.TemplateSource {
+	return hccommon.TemplateSource{ID: c.TemplateID, Slug: c.TemplateSlug, Name: c.TemplateName}
+}
+
+// ConfigSpec describes the builder's options to HCL2 templates. JSON
+// templates are still decoded by Prepare alone.
+func (self *Builder) ConfigSpec() hcldec.ObjectSpec {
+	return self.config.FlatMapstructure().HCL2Spec()
+}
+
+func (self *Builder) Prepare(raws ...interface{}) ([]string, []string, error) {
 	err := config.Decode(&self.config, &config.DecodeOpts{
-		Interpolate: true,
+		PluginType:         "hypercloud-clone",
+		Interpolate:        true,
+		InterpolateContext: &self.config.ctx,
 		InterpolateFilter: &interpolate.RenderFilter{
 			Exclude: []string{
 				"boot_command",
+				"disk_name",
+				"disk_description",
 			},
 		},
 	}, raws...)
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	var errs *packer.MultiError
+	var errs *packersdk.MultiError
 
 	// Set defaults
 
 	self.config.virtualization = "hvm" // We could do pv, but need to add serial support to this plugin
 
-	if self.config.DiskSize == 0 {
-		self.config.DiskSize = 10
+	if self.config.templateSource().Given() != 1 {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("must provide 1 of template_id, template_name or template_slug"))
 	}
 
-	if self.config.Memory == 0 {
-		self.config.Memory = 512
-	}
-
-	templatePresentCount := 0
-	if self.config.TemplateID != "" {
-		templatePresentCount += 1
-	}
-	if self.config.TemplateName != "" {
-		templatePresentCount += 1
+	if es := self.config.AccessConfig.Prepare(); len(es) > 0 {
+		errs = packersdk.MultiErrorAppend(errs, es...)
 	}
-	if self.config.TemplateSlug != "" {
-		templatePresentCount += 1
+	if es := self.config.RunConfig.Prepare(); len(es) > 0 {
+		errs = packersdk.MultiErrorAppend(errs, es...)
 	}
-	if templatePresentCount != 1 {
-		errs = packer.MultiErrorAppend(errs, fmt.Errorf("must provide 1 of template_id, template_name or template_slug"))
-	}
-
-	if self.config.HYPERCLOUD_URL == "" {
-		errs = packer.MultiErrorAppend(errs, fmt.Errorf("hypercloud_url is required"))
+	if es := self.config.Comm.Prepare(&self.config.ctx); len(es) > 0 {
+		errs = packersdk.MultiErrorAppend(errs, es...)
 	}
-
-	if self.config.HYPERCLOUD_ID != "" || self.config.HYPERCLOUD_SECRET != "" {
-		if self.config.HYPERCLOUD_ID == "" {
-			errs = packer.MultiErrorAppend(errs, fmt.Errorf("hypercloud_id is required when hypercloud_secret is provided"))
-		} else if self.config.HYPERCLOUD_SECRET == "" {
-			errs = packer.MultiErrorAppend(errs, fmt.Errorf("hypercloud_secret is required when hypercloud_id is provided"))
-		}
-	} else if self.config.HYPERCLOUD_ACCESS_TOKEN == "" {
-		errs = packer.MultiErrorAppend(errs, fmt.Errorf("either hypercloud_access_token or both hypercloud_id and hypercloud_secret are required"))
+	if es := self.config.LocationConfig.Prepare(); len(es) > 0 {
+		errs = packersdk.MultiErrorAppend(errs, es...)
 	}
-
-	if self.config.DiskPerformanceTierID == "" {
-		errs = packer.MultiErrorAppend(errs, fmt.Errorf("disk_performance_tier_id is required"))
+	if es := self.config.ArtifactNameConfig.Prepare(&self.config.ctx); len(es) > 0 {
+		errs = packersdk.MultiErrorAppend(errs, es...)
 	}
-	if self.config.InstancePerformanceTierID == "" {
-		errs = packer.MultiErrorAppend(errs, fmt.Errorf("instance_performance_tier_id is required"))
+	if es := self.config.PublishConfig.Prepare(); len(es) > 0 {
+		errs = packersdk.MultiErrorAppend(errs, es...)
 	}
-
-	if self.config.NetworkID == "" {
-		errs = packer.MultiErrorAppend(errs, fmt.Errorf("network_id is required"))
+	source := "template:" + self.config.templateSource().String()
+	if es := self.config.TagConfig.Prepare(self.config.PackerBuildName, source); len(es) > 0 {
+		errs = packersdk.MultiErrorAppend(errs, es...)
 	}
 
-	if es := self.config.Comm.Prepare(&self.config.ctx); len(es) > 0 {
-		errs = packer.MultiErrorAppend(errs, es...)
+	if errs != nil && len(errs.Errors) > 0 {
+		return nil, nil, errs
 	}
 
-	if errs != nil && len(errs.Errors) > 0 {
-		return nil, errs
+	// Only check the resources once the config is otherwise valid
+	if self.config.Preflight {
+		preflight := &hccommon.Preflight{Client: self.config.Client(nil)}
+		if preflight.Connect() {
+			if region := preflight.Location(&self.config.LocationConfig); region != "" {
+				preflight.Template("template", self.config.templateSource(), region, self.config.DiskSize)
+			}
+		}
+		if len(preflight.Errors) > 0 {
+			return nil, nil, packersdk.MultiErrorAppend(nil, preflight.Errors...)
+		}
 	}
-	return nil, nil
+	return nil, nil, nil
 }
 
-func (self *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packer.Artifact, error) {
-	var client hypercloud.ApiClient
-	if self.config.HYPERCLOUD_ACCESS_TOKEN == "" {
-		client = hypercloud.NewApplicationClient(self.config.HYPERCLOUD_URL, self.config.HYPERCLOUD_ID, self.config.HYPERCLOUD_SECRET)
-	} else {
-		client = hypercloud.NewAccessTokenClient(self.config.HYPERCLOUD_URL, self.config.HYPERCLOUD_ACCESS_TOKEN)
-	}
+func (self *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook) (packersdk.Artifact, error) {
+	// ctx is cancelled by Packer on interrupt, stopping any in-flight polling
+	client := self.config.Client(ui)
+	client.Context = ctx
 
 	//Share state between the other steps using a statebag
 	state := new(multistep.BasicStateBag)
-	state.Put("cache", cache)
-	state.Put("client", &client)
+	state.Put("client", client)
+	state.Put("context", ctx)
 	state.Put("config", &self.config)
 	state.Put("hook", hook)
 	state.Put("ui", ui)
 
 	steps := []multistep.Step{
 		new(stepCreateDisk),
-		new(stepAllocateIP),
-		new(stepBuildInstance),
+		&hccommon.StepAllocateIP{
+			Location:  &self.config.LocationConfig,
+			BuildName: self.config.PackerBuildName,
+			Tags:      self.config.BuildTags(),
+		},
+		&hccommon.StepBuildInstance{
+			Config:     &self.config.RunConfig,
+			Location:   &self.config.LocationConfig,
+			BuildName:  self.config.PackerBuildName,
+			Tags:       self.config.BuildTags(),
+			DiskKeys:   []string{"disk"},
+			BootDevice: "disk",
+		},
 		new(stepConfigurePublicKey),
-		new(stepBootInstance),
+		&hccommon.StepBootInstance{Config: &self.config.RunConfig},
 		&communicator.StepConnect{
 			Config: &self.config.Comm,
-			Host:   commHost,
+			Host:   hccommon.CommHost,
+		},
+		new(commonsteps.StepProvision),
+		&hccommon.StepShutdown{Config: &self.config.RunConfig},
+		new(hccommon.StepCleanup),
+		&hccommon.StepNameDisk{
+			Config:    &self.config.ArtifactNameConfig,
+			Ctx:       &self.config.ctx,
+			BuildName: self.config.PackerBuildName,
+			Tags:      self.config.ArtifactTags(),
+			SourceName: func(state multistep.StateBag) string {
+				return state.Get("template").(*api.Template).Name
+			},
+		},
+		&hccommon.StepPublishTemplate{
+			Config: &self.config.PublishConfig,
+			Tags:   self.config.ArtifactTags(),
 		},
-		new(common.StepProvision),
-		new(stepShutdown),
-		new(stepCleanup),
 	}
 
 	// Run!
-	if self.config.PackerDebug {
-		self.runner = &multistep.DebugRunner{
-			Steps:   steps,
-			PauseFn: common.MultistepDebugFn(ui),
-		}
-	} else {
-		self.runner = &multistep.BasicRunner{Steps: steps}
-	}
+	runner := commonsteps.NewRunner(steps, self.config.PackerConfig, ui)
+	runner.Run(ctx, state)
+	hccommon.ReportLeaks(ui, state, self.config.PackerOnError)
 
-	self.runner.Run(state)
-
-	// If there was an error, return that
-	if rawErr, ok := state.GetOk("error"); ok {
-		return nil, rawErr.(error)
-	}
-
-	// If we were interrupted or cancelled, then just exit.
-	if _, ok := state.GetOk(multistep.StateCancelled); ok {
-		return nil, errors.New("Build was cancelled.")
+	if err := hccommon.RunError(state); err != nil {
+		return nil, err
 	}
 
-	if _, ok := state.GetOk(multistep.StateHalted); ok {
-		return nil, errors.New("Build was halted.")
+	artifact := &hccommon.Artifact{
+		DiskBuilderID: hccommon.CloneBuilderID,
+		Disk:          state.Get("disk").(*api.Disk),
+		Client:        client,
 	}
-
-	disk := state.Get("disk").(map[string]interface{})
-	diskId := disk["id"].(string)
-
-	// Rename the disk to signify success
-	timeStr := time.Now().Format("2006-01-02 15:04:05")
-	newDiskName := fmt.Sprintf("Packer completed: %s %s", self.config.PackerBuildName, timeStr)
-	disk, _ = api.UpdateDisk(&client, diskId, map[string]interface{}{
-		"name": newDiskName,
-	})
-
-	artifact := &Artifact{
-		diskId: diskId,
-		state:  disk,
-		client: &client,
+	if template, ok := state.GetOk("template_published"); ok {
+		artifact.Template = template.(*api.Template)
 	}
 	return artifact, nil
 }
-
-func (self *Builder) Cancel() {
-	if self.runner != nil {
-		log.Println("Cancelling the step runner...")
-		self.runner.Cancel()
-	}
-	fmt.Println("Cancelling the builder")
-}
@@ -0,0 +1,148 @@
+package clone
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/thehypercloud/packer-hypercloud/api"
+	"github.com/thehypercloud/packer-hypercloud/api/hypercloudtest"
+	hccommon "github.com/thehypercloud/packer-hypercloud/builder/hypercloud/common"
+)
+
+// testConfig is a valid config for a build against srv, which doesn't need
+// to connect to the instance
+func testConfig(t *testing.T, srv *hypercloudtest.Server, f hypercloudtest.Fixture) map[string]interface{} {
+	key := filepath.Join(t.TempDir(), "id_test")
+	if err := os.WriteFile(key+".pub", []byte("ssh-ed25519 AAAAtest packer@test\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return map[string]interface{}{
+		"packer_build_name":            "web",
+		"communicator":                 "none",
+		"ssh_private_key_file":         key,
+		"shutdown_from_api":            true,
+		"template_slug":                "ubuntu-16.04",
+		"disk_performance_tier_id":     f.DiskTierID,
+		"instance_performance_tier_id": f.InstanceTierID,
+		"network_id":                   f.NetworkID,
+		"disk_name":                    "web {{build_name}} from {{.SourceTemplate}}",
+		"hypercloud_url":               srv.URL,
+		"hypercloud_access_token":      hypercloudtest.Token,
+	}
+}
+
+func TestBuilderPrepareErrors(t *testing.T) {
+	srv := hypercloudtest.NewServer()
+	defer srv.Close()
+	f := srv.Seed()
+
+	for _, tc := range []struct {
+		name   string
+		change map[string]interface{}
+	}{
+		{"no template", map[string]interface{}{"template_slug": ""}},
+		{"two templates", map[string]interface{}{"template_id": f.TemplateID}},
+		{"no network", map[string]interface{}{"network_id": ""}},
+		{"bad disk_name", map[string]interface{}{"disk_name": "{{"}},
+		{"two shutdowns", map[string]interface{}{"shutdown_command": "poweroff"}},
+		{"missing template", map[string]interface{}{"template_slug": "missing", "preflight": true}},
+	} {
+		config := testConfig(t, srv, f)
+		for k, v := range tc.change {
+			config[k] = v
+		}
+		var b Builder
+		if _, _, err := b.Prepare(config); err == nil {
+			t.Errorf("%s: Prepare succeeded, want an error", tc.name)
+		}
+	}
+}
+
+func TestBuilderRun(t *testing.T) {
+	srv := hypercloudtest.NewServer()
+	defer srv.Close()
+	f := srv.Seed()
+	srv.Polls = 2
+
+	config := testConfig(t, srv, f)
+	config["publish_template_name"] = "web"
+	config["preflight"] = true
+	var b Builder
+	if _, _, err := b.Prepare(config); err != nil {
+		t.Fatalf("Prepare: %s", err)
+	}
+	hook := &packersdk.MockHook{}
+	artifact, err := b.Run(context.Background(), packersdk.TestUi(t), hook)
+	if err != nil {
+		t.Fatalf("Run: %s\nrequests:\n%s", err, strings.Join(srv.Requests(), "\n"))
+	}
+	if !hook.RunCalled || hook.RunName != packersdk.HookProvision {
+		t.Errorf("provision hook not run")
+	}
+
+	// The finished disk is named, tagged as the artifact and published
+	a := artifact.(*hccommon.Artifact)
+	disk, ok := srv.Disk(a.Disk.ID)
+	if !ok {
+		t.Fatalf("artifact disk %s does not exist", a.Disk.ID)
+	}
+	if want := "web web from Ubuntu 16.04"; disk.Name != want {
+		t.Errorf("disk is named %q, want %q", disk.Name, want)
+	}
+	if disk.State != "unattached" {
+		t.Errorf("disk is %s, want it unattached", disk.State)
+	}
+	if disk.Tags[hccommon.TagArtifact] != "true" || disk.Tags[hccommon.TagBuildName] != "web" {
+		t.Errorf("disk tags are %v", disk.Tags)
+	}
+	if a.Template == nil || a.Template.Name != "web" || a.Template.Version != 1 {
+		t.Errorf("published template is %+v, want version 1 of web", a.Template)
+	}
+
+	// Nothing else the build created is left behind
+	instances, err := api.InstanceList(srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, instance := range instances {
+		// The build instance is terminated without waiting for it to finish
+		if instance.ID != f.DownloaderID && instance.State != "terminating" && instance.State != "terminated" {
+			t.Errorf("instance %s (%s) is %s", instance.ID, instance.Name, instance.State)
+		}
+	}
+	if ips := srv.AllocatedIPs(); len(ips) != 1 {
+		t.Errorf("ip addresses %v are allocated, want only the downloader's", ips)
+	}
+	if ids := srv.DiskIDs(); len(ids) != 2 {
+		t.Errorf("disks %v exist, want only the downloader's and the artifact", ids)
+	}
+}
+
+func TestBuilderRunRollsBack(t *testing.T) {
+	srv := hypercloudtest.NewServer()
+	defer srv.Close()
+	f := srv.Seed()
+
+	var b Builder
+	if _, _, err := b.Prepare(testConfig(t, srv, f)); err != nil {
+		t.Fatalf("Prepare: %s", err)
+	}
+	hook := &packersdk.MockHook{RunFunc: func(context.Context) error {
+		return errors.New("provisioner failed")
+	}}
+	if _, err := b.Run(context.Background(), packersdk.TestUi(t), hook); err == nil {
+		t.Fatal("Run succeeded despite the provisioner failing")
+	}
+
+	if ids := srv.DiskIDs(); len(ids) != 1 || ids[0] != f.DownloaderDiskID {
+		t.Errorf("disks %v exist, want only the downloader's", ids)
+	}
+	if ips := srv.AllocatedIPs(); len(ips) != 1 {
+		t.Errorf("ip addresses %v are allocated, want only the downloader's", ips)
+	}
+}
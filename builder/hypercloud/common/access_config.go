@@ -0,0 +1,258 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/thehypercloud/packer-hypercloud/api"
+)
+
+// Environment variables read for settings missing from the template
+const (
+	EnvURL             = "HYPERCLOUD_URL"
+	EnvID              = "HYPERCLOUD_ID"
+	EnvSecret          = "HYPERCLOUD_SECRET"
+	EnvAccessToken     = "HYPERCLOUD_ACCESS_TOKEN"
+	EnvProfile         = "HYPERCLOUD_PROFILE"
+	EnvCredentialsFile = "HYPERCLOUD_CREDENTIALS_FILE"
+)
+
+// DefaultProfile is the credentials file profile used when none is named
+const DefaultProfile = "default"
+
+// AccessConfig is how to reach and authenticate with the HyperCloud API.
+// Settings missing from the template are taken from the environment and
+// then from a profile in the credentials file.
+type AccessConfig struct {
+	HYPERCLOUD_URL          string `mapstructure:"hypercloud_url"`
+	HYPERCLOUD_ID           string `mapstructure:"hypercloud_id"`
+	HYPERCLOUD_SECRET       string `mapstructure:"hypercloud_secret"`
+	HYPERCLOUD_ACCESS_TOKEN string `mapstructure:"hypercloud_access_token"`
+	Profile                 string `mapstructure:"hypercloud_profile"`
+	CredentialsFile         string `mapstructure:"hypercloud_credentials_file"`
+	APIRetryMax             int    `mapstructure:"api_retry_max"`
+	RawAPIRetryTimeout      string `mapstructure:"api_retry_timeout"`
+
+	apiRetryTimeout time.Duration
+}
+
+// Credentials are the settings a source of defaults can provide
+type Credentials struct {
+	URL         string
+	ID          string
+	Secret      string
+	AccessToken string
+}
+
+// hasKey is whether the credentials include a way to authenticate. The id,
+// secret and access token are taken together from a single source, so that
+// a token in the environment isn't mixed with an id in the template.
+func (c Credentials) hasKey() bool {
+	return c.ID != "" || c.Secret != "" || c.AccessToken != ""
+}
+
+func (c *AccessConfig) credentials() Credentials {
+	return Credentials{
+		URL:         c.HYPERCLOUD_URL,
+		ID:          c.HYPERCLOUD_ID,
+		Secret:      c.HYPERCLOUD_SECRET,
+		AccessToken: c.HYPERCLOUD_ACCESS_TOKEN,
+	}
+}
+
+func (c *AccessConfig) setDefaults(d Credentials) {
+	if c.HYPERCLOUD_URL == "" {
+		c.HYPERCLOUD_URL = d.URL
+	}
+	if !c.credentials().hasKey() {
+		c.HYPERCLOUD_ID = d.ID
+		c.HYPERCLOUD_SECRET = d.Secret
+		c.HYPERCLOUD_ACCESS_TOKEN = d.AccessToken
+	}
+}
+
+// EnvCredentials returns the credentials set in the environment
+func EnvCredentials() Credentials {
+	return Credentials{
+		URL:         os.Getenv(EnvURL),
+		ID:          os.Getenv(EnvID),
+		Secret:      os.Getenv(EnvSecret),
+		AccessToken: os.Getenv(EnvAccessToken),
+	}
+}
+
+func (c *AccessConfig) Prepare() []error {
+	var errs []error
+
+	// A profile named in the template is used in preference to credentials
+	// in the environment; otherwise the environment comes first, then the
+	// profile named by HYPERCLOUD_PROFILE or the default one.
+	if c.Profile == "" {
+		c.setDefaults(EnvCredentials())
+		c.Profile = os.Getenv(EnvProfile)
+	}
+	if c.CredentialsFile == "" {
+		c.CredentialsFile = os.Getenv(EnvCredentialsFile)
+	}
+	if c.HYPERCLOUD_URL == "" || !c.credentials().hasKey() {
+		profile, err := LoadProfile(c.CredentialsFile, c.Profile)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			c.setDefaults(profile)
+		}
+	}
+
+	if c.HYPERCLOUD_URL == "" {
+		errs = append(errs, fmt.Errorf("hypercloud_url is required, from the template, %s or the credentials file", EnvURL))
+	}
+	if c.HYPERCLOUD_ID != "" || c.HYPERCLOUD_SECRET != "" {
+		if c.HYPERCLOUD_ID == "" {
+			errs = append(errs, fmt.Errorf("hypercloud_id is required when hypercloud_secret is provided"))
+		} else if c.HYPERCLOUD_SECRET == "" {
+			errs = append(errs, fmt.Errorf("hypercloud_secret is required when hypercloud_id is provided"))
+		}
+	} else if c.HYPERCLOUD_ACCESS_TOKEN == "" {
+		errs = append(errs, fmt.Errorf("either hypercloud_access_token or both hypercloud_id and hypercloud_secret are required, from the template, the environment or the credentials file"))
+	}
+
+	if c.RawAPIRetryTimeout == "" {
+		c.RawAPIRetryTimeout = "5m"
+	}
+	if c.APIRetryMax < 0 {
+		errs = append(errs, fmt.Errorf("api_retry_max must not be negative"))
+	}
+	if timeout, err := time.ParseDuration(c.RawAPIRetryTimeout); err != nil {
+		errs = append(errs, fmt.Errorf("Failed parsing api_retry_timeout: %s", err))
+	} else {
+		c.apiRetryTimeout = timeout
+	}
+	return errs
+}
+
+// Client returns a client for the HyperCloud API. Retries are reported to
+// ui, unless it is nil.
+func (c *AccessConfig) Client(ui packersdk.Ui) *api.Client {
+	client := api.Connect(api.Endpoint{
+		URL:         c.HYPERCLOUD_URL,
+		ID:          c.HYPERCLOUD_ID,
+		Secret:      c.HYPERCLOUD_SECRET,
+		AccessToken: c.HYPERCLOUD_ACCESS_TOKEN,
+	})
+	client.Retry = api.RetryPolicy{
+		MaxRetries: c.APIRetryMax,
+		Timeout:    c.apiRetryTimeout,
+	}
+	if ui != nil {
+		client.OnRetry = func(err error, attempt int, wait time.Duration) {
+			ui.Message(fmt.Sprintf("HyperCloud API call failed, retrying in %s (attempt %d of %d): %s",
+				wait, attempt, c.APIRetryMax, err))
+		}
+	}
+	return client
+}
+
+// DefaultCredentialsFile returns ~/.hypercloud/credentials
+func DefaultCredentialsFile() (string, error) {
+	home := os.Getenv("HOME")
+	if home == "" {
+		home = os.Getenv("USERPROFILE")
+	}
+	if home == "" {
+		u, err := user.Current()
+		if err != nil {
+			return "", fmt.Errorf("Error finding home directory for the credentials file: %w", err)
+		}
+		home = u.HomeDir
+	}
+	return filepath.Join(home, ".hypercloud", "credentials"), nil
+}
+
+// LoadProfile reads a profile from an INI style credentials file, by default
+// ~/.hypercloud/credentials:
+//
+//	[default]
+//	url = https://my.cloud.example.net
+//	access_token = ...
+//
+//	[staging]
+//	url = https://staging.example.net
+//	id = ...
+//	secret = ...
+//
+// It is only an error for the file or profile to be missing if either was
+// named; otherwise no credentials are returned.
+func LoadProfile(path string, profile string) (Credentials, error) {
+	named := path != "" || profile != ""
+	if profile == "" {
+		profile = DefaultProfile
+	}
+	if path == "" {
+		var err error
+		if path, err = DefaultCredentialsFile(); err != nil {
+			return Credentials{}, err
+		}
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && !named {
+		return Credentials{}, nil
+	} else if err != nil {
+		return Credentials{}, fmt.Errorf("Error reading credentials file: %w", err)
+	}
+	defer f.Close()
+
+	var creds Credentials
+	found := false
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if section == profile {
+				found = true
+			}
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return Credentials{}, fmt.Errorf("%s:%d: expected key = value", path, n)
+		}
+		if section != profile {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+		switch key := strings.TrimSpace(parts[0]); key {
+		case "url":
+			creds.URL = value
+		case "id":
+			creds.ID = value
+		case "secret":
+			creds.Secret = value
+		case "access_token":
+			creds.AccessToken = value
+		default:
+			return Credentials{}, fmt.Errorf("%s:%d: unknown key %q", path, n, key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Credentials{}, fmt.Errorf("Error reading credentials file: %w", err)
+	}
+	if !found {
+		if !named {
+			return Credentials{}, nil
+		}
+		return Credentials{}, fmt.Errorf("%s: no profile named %q", path, profile)
+	}
+	return creds, nil
+}
@@ -0,0 +1,140 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testCredentials = `
+# comment
+; also a comment
+[default]
+url = https://my.cloud.example.net
+access_token = token
+
+[ staging ]
+url=https://staging.example.net
+id = staging-id
+secret = a=b
+
+[empty]
+`
+
+func writeCredentials(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "credentials")
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadProfile(t *testing.T) {
+	path := writeCredentials(t, testCredentials)
+	for _, tc := range []struct {
+		profile string
+		want    Credentials
+		err     bool
+	}{
+		{"", Credentials{URL: "https://my.cloud.example.net", AccessToken: "token"}, false},
+		{"default", Credentials{URL: "https://my.cloud.example.net", AccessToken: "token"}, false},
+		{"staging", Credentials{URL: "https://staging.example.net", ID: "staging-id", Secret: "a=b"}, false},
+		{"empty", Credentials{}, false},
+		{"missing", Credentials{}, true},
+	} {
+		got, err := LoadProfile(path, tc.profile)
+		if tc.err {
+			if err == nil {
+				t.Errorf("profile %q: got %+v, want an error", tc.profile, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("profile %q: %s", tc.profile, err)
+		} else if got != tc.want {
+			t.Errorf("profile %q: got %+v, want %+v", tc.profile, got, tc.want)
+		}
+	}
+}
+
+func TestLoadProfileErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		contents string
+	}{
+		{"no equals", "[default]\nurl\n"},
+		{"unknown key", "[default]\nregion = r1\n"},
+		{"malformed in another profile", "[other]\nurl\n[default]\nurl = https://example.net\n"},
+	} {
+		if got, err := LoadProfile(writeCredentials(t, tc.contents), ""); err == nil {
+			t.Errorf("%s: got %+v, want an error", tc.name, got)
+		}
+	}
+}
+
+func TestLoadProfileMissingFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	// Without a file or profile named, missing defaults are not an error
+	if got, err := LoadProfile("", ""); err != nil || got != (Credentials{}) {
+		t.Errorf("default file missing: got %+v, %v", got, err)
+	}
+	if _, err := LoadProfile("", "staging"); err == nil {
+		t.Errorf("named profile with the default file missing: want an error")
+	}
+	if _, err := LoadProfile(filepath.Join(home, "missing"), ""); err == nil {
+		t.Errorf("named file missing: want an error")
+	}
+
+	// The default file is ~/.hypercloud/credentials
+	if err := os.MkdirAll(filepath.Join(home, ".hypercloud"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".hypercloud", "credentials"), []byte("[other]\nid = x\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := LoadProfile("", ""); err != nil || got != (Credentials{}) {
+		t.Errorf("default profile missing: got %+v, %v", got, err)
+	}
+	if got, err := LoadProfile("", "other"); err != nil || got.ID != "x" {
+		t.Errorf("profile from the default file: got %+v, %v", got, err)
+	}
+}
+
+func TestAccessConfigPrepareSources(t *testing.T) {
+	path := writeCredentials(t, testCredentials)
+	for _, env := range []string{EnvURL, EnvID, EnvSecret, EnvAccessToken, EnvProfile} {
+		t.Setenv(env, "")
+	}
+	t.Setenv(EnvCredentialsFile, path)
+	t.Setenv(EnvAccessToken, "env-token")
+
+	// The environment's token is used before the default profile's, but
+	// the url still comes from the profile
+	c := &AccessConfig{}
+	if errs := c.Prepare(); len(errs) > 0 {
+		t.Fatalf("Prepare: %v", errs)
+	}
+	if c.HYPERCLOUD_URL != "https://my.cloud.example.net" || c.HYPERCLOUD_ACCESS_TOKEN != "env-token" {
+		t.Errorf("environment then default profile: got %+v", c.credentials())
+	}
+
+	// A profile named in the template takes precedence over the environment
+	c = &AccessConfig{Profile: "staging"}
+	if errs := c.Prepare(); len(errs) > 0 {
+		t.Fatalf("Prepare: %v", errs)
+	}
+	if got, want := c.credentials(), (Credentials{URL: "https://staging.example.net", ID: "staging-id", Secret: "a=b"}); got != want {
+		t.Errorf("named profile: got %+v, want %+v", got, want)
+	}
+
+	// An id in the template isn't mixed with a token from elsewhere
+	c = &AccessConfig{HYPERCLOUD_ID: "id"}
+	if errs := c.Prepare(); len(errs) != 1 {
+		t.Errorf("id without a secret: got errors %v, want one", errs)
+	}
+	if c.HYPERCLOUD_ACCESS_TOKEN != "" {
+		t.Errorf("id without a secret: token %q was filled in", c.HYPERCLOUD_ACCESS_TOKEN)
+	}
+}
@@ -0,0 +1,135 @@
+package common
+
+import (
+	"fmt"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/thehypercloud/packer-hypercloud/api"
+)
+
+// Builder ids of the artifacts: a finished disk from either builder, or a
+// template published from one
+const (
+	CloneBuilderID    = "hypercloud.clone.disk"
+	VNCBuilderID      = "hypercloud.vnc.disk"
+	TemplateBuilderID = "hypercloud.template"
+)
+
+// Artifact is a build's finished disk or, when the build published one, the
+// template made from it. A template's Id is the template's, so it can be
+// given to the clone builder's template_id.
+type Artifact struct {
+	DiskBuilderID string // the builder id when no template was published
+	Disk          *api.Disk
+	Template      *api.Template
+	Client        *api.Client
+}
+
+func (a *Artifact) BuilderId() string {
+	if a.Template != nil {
+		return TemplateBuilderID
+	}
+	return a.DiskBuilderID
+}
+
+func (a *Artifact) Files() []string {
+	return make([]string, 0) // empty slice - no files generated
+}
+
+func (a *Artifact) Id() string {
+	if a.Template != nil {
+		return a.Template.ID
+	}
+	return a.Disk.ID
+}
+
+func (a *Artifact) String() string {
+	if a.Template != nil {
+		return fmt.Sprintf("Template: %s : %s version %d (from disk %s)",
+			a.Template.ID, a.Template.Name, a.Template.Version, a.Disk.ID)
+	}
+	return fmt.Sprintf("Disk: %s : %s", a.Disk.ID, a.Disk.Name)
+}
+
+func (a *Artifact) State(name string) interface{} {
+	if a.Template != nil {
+		return a.templateState(name)
+	}
+	switch name {
+	case "id":
+		return a.Disk.ID
+	case "name":
+		return a.Disk.Name
+	case "description":
+		return a.Disk.Description
+	case "region":
+		return a.Disk.Region.ID
+	case "tags":
+		return map[string]string(a.Disk.Tags)
+	}
+	return nil
+}
+
+func (a *Artifact) templateState(name string) interface{} {
+	switch name {
+	case "id", "template_id":
+		return a.Template.ID
+	case "name", "template_name":
+		return a.Template.Name
+	case "slug", "template_slug":
+		return a.Template.Slug
+	case "version", "template_version":
+		return a.Template.Version
+	case "region":
+		return a.Template.Region.ID
+	case "disk_id":
+		return a.Disk.ID
+	case "tags":
+		return map[string]string(a.Template.Tags)
+	}
+	return nil
+}
+
+// ArtifactTemplate returns the template of an artifact with builder id
+// TemplateBuilderID, and the id of the disk it was published from, read
+// from the artifact's state. Post-processors may be given an artifact from
+// another version of the plugin, so missing state is an error rather than
+// assumed.
+func ArtifactTemplate(artifact packersdk.Artifact) (*api.Template, string, error) {
+	template := &api.Template{ID: artifact.Id()}
+	var diskID string
+	for _, field := range []struct {
+		key   string
+		value *string
+	}{
+		{"template_name", &template.Name},
+		{"template_slug", &template.Slug},
+		{"region", &template.Region.ID},
+		{"disk_id", &diskID},
+	} {
+		value, ok := artifact.State(field.key).(string)
+		if !ok {
+			return nil, "", fmt.Errorf("Template artifact %s has no %s in its state", artifact.Id(), field.key)
+		}
+		*field.value = value
+	}
+	tags, ok := artifact.State("tags").(map[string]string)
+	if !ok {
+		return nil, "", fmt.Errorf("Template artifact %s has no tags in its state", artifact.Id())
+	}
+	template.Tags = api.Tags(tags)
+	return template, diskID, nil
+}
+
+// Destroy deletes the disk, and the template published from it if any
+func (a *Artifact) Destroy() error {
+	if a.Template != nil {
+		if err := api.TemplateDelete(a.Client, a.Template.ID); err != nil && !api.IsNotFound(err) {
+			return err
+		}
+	}
+	if err := api.DiskDelete(a.Client, a.Disk.ID); err != nil && !api.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
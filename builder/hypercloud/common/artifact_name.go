@@ -0,0 +1,78 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/thehypercloud/packer-hypercloud/api"
+)
+
+// DefaultDiskName is the name given to the finished disk when disk_name is
+// not set
+const DefaultDiskName = `Packer completed: {{build_name}} {{isotime "2006-01-02 15:04:05"}}`
+
+// ArtifactNameConfig is squashed into each builder's Config to name the
+// finished disk. Both options are templates, and must be excluded from
+// interpolation when the config is decoded so that they are rendered when
+// the build finishes.
+type ArtifactNameConfig struct {
+	DiskName        string `mapstructure:"disk_name"`
+	DiskDescription string `mapstructure:"disk_description"`
+}
+
+// ArtifactNameData is available to disk_name and disk_description, along
+// with {{timestamp}}, {{isotime}}, {{build_name}} and user variables
+type ArtifactNameData struct {
+	BuildName      string
+	SourceTemplate string
+}
+
+func (c *ArtifactNameConfig) Prepare(ctx *interpolate.Context) []error {
+	if c.DiskName == "" {
+		c.DiskName = DefaultDiskName
+	}
+
+	// Render once with placeholder data to catch syntax errors now, rather
+	// than after the whole build has run
+	var errs []error
+	if _, _, err := c.Render(*ctx, ArtifactNameData{}); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Render returns the finished disk's name and description
+func (c *ArtifactNameConfig) Render(ctx interpolate.Context, data ArtifactNameData) (name string, description string, err error) {
+	ctx.Data = &data
+	name, err = interpolate.Render(c.DiskName, &ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("Error rendering disk_name: %w", err)
+	}
+	description, err = interpolate.Render(c.DiskDescription, &ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("Error rendering disk_description: %w", err)
+	}
+	return name, description, nil
+}
+
+// NameDisk renames and tags the finished disk to signify success, and
+// returns it as updated. A disk that can't be named is still marked as in
+// progress, so the build must fail rather than report it as an artifact.
+func (c *ArtifactNameConfig) NameDisk(client *api.Client, disk *api.Disk, ctx interpolate.Context, data ArtifactNameData, tags api.Tags) (*api.Disk, error) {
+	name, description, err := c.Render(ctx, data)
+	if err == nil && name == "" {
+		err = fmt.Errorf("disk_name rendered as an empty string")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error naming disk %s: %w", disk.ID, err)
+	}
+	renamed, err := api.UpdateDisk(client, disk.ID, map[string]interface{}{
+		"name":        name,
+		"description": description,
+		"tags":        map[string]string(tags),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error renaming disk %s: %w", disk.ID, err)
+	}
+	return renamed, nil
+}
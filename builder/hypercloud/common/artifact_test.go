@@ -0,0 +1,38 @@
+package common
+
+import (
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestArtifactTemplate(t *testing.T) {
+	state := map[string]interface{}{
+		"template_name": "Web",
+		"template_slug": "web",
+		"region":        "r1",
+		"disk_id":       "d1",
+		"tags":          map[string]string{"a": "b"},
+	}
+	artifact := &packersdk.MockArtifact{IdValue: "t1", StateValues: state}
+	template, diskID, err := ArtifactTemplate(artifact)
+	if err != nil {
+		t.Fatalf("ArtifactTemplate: %s", err)
+	}
+	if template.ID != "t1" || template.Name != "Web" || template.Slug != "web" || template.Region.ID != "r1" || template.Tags["a"] != "b" || diskID != "d1" {
+		t.Errorf("got %+v from disk %s", template, diskID)
+	}
+
+	for key := range state {
+		missing := make(map[string]interface{})
+		for k, v := range state {
+			if k != key {
+				missing[k] = v
+			}
+		}
+		artifact := &packersdk.MockArtifact{IdValue: "t1", StateValues: missing}
+		if _, _, err := ArtifactTemplate(artifact); err == nil {
+			t.Errorf("expected an error without %s", key)
+		}
+	}
+}
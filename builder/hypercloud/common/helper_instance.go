@@ -0,0 +1,295 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	commonssh "github.com/hashicorp/packer-plugin-sdk/communicator/ssh"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/sdk-internals/communicator/ssh"
+	"github.com/thehypercloud/packer-hypercloud/api"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// HelperInstance is an instance used to read and write disks over SSH,
+// such as the vnc builder's downloader VM. It is either long-running, or
+// launched for the build by LaunchHelperInstance.
+type HelperInstance struct {
+	ID        string
+	SSHConfig *gossh.ClientConfig
+
+	// The resources of a launched helper, released by Destroy
+	diskID string
+	ipID   string
+
+	// Whether Attach booted the helper, which Restore stops again
+	booted bool
+}
+
+// How many times to look for a disk's device on a helper after attaching it
+const helperDeviceAttempts = 5
+
+// HelperLaunch describes a throwaway helper instance, launched from a
+// template with its own disk and IP address
+type HelperLaunch struct {
+	Name           string
+	Template       TemplateSource
+	Region         string
+	DiskTierID     string
+	InstanceTierID string
+	NetworkID      string
+	Memory         uint
+	SSHPassword    string
+	SSHPrivateKey  string
+	SSHWaitTimeout time.Duration
+	Tags           api.Tags
+}
+
+// LaunchHelperInstance creates a helper instance from a template, boots it
+// and waits for SSH to be reachable. Unless a password is used, the public
+// key of SSHPrivateKey is given to the instance. The helper is returned
+// even on error, so that whatever was created can be destroyed.
+func LaunchHelperInstance(ctx context.Context, client *api.Client, ui packersdk.Ui, launch *HelperLaunch, sshConfig *gossh.ClientConfig) (*HelperInstance, error) {
+	h := &HelperInstance{SSHConfig: sshConfig}
+
+	template, err := launch.Template.Find(client, launch.Region)
+	if err != nil {
+		return h, err
+	}
+
+	ui.Say(fmt.Sprintf("Launching helper instance from template %s", template.Name))
+	disk, err := api.CreateTemplateDisk(ctx, client, 10, launch.Name, launch.Region, launch.DiskTierID, template.ID, launch.Tags)
+	if disk != nil {
+		h.diskID = disk.ID
+	}
+	if err != nil {
+		return h, fmt.Errorf("Error creating helper instance disk: %w", err)
+	}
+
+	ip, err := api.AllocateIP(client, launch.NetworkID, launch.Name, launch.Tags)
+	if err != nil {
+		return h, fmt.Errorf("Error allocating helper instance IP address: %w", err)
+	}
+	h.ipID = ip.ID
+
+	instance, err := api.InstanceCreate(client, launch.Name, launch.Memory, launch.InstanceTierID, launch.Region,
+		[]string{disk.ID}, []string{ip.ID}, "disk", launch.Tags)
+	if err != nil {
+		return h, fmt.Errorf("Error creating helper instance: %w", err)
+	}
+	h.ID = instance.ID
+	ui.Say(fmt.Sprintf("Helper instance created with ID: %s", instance.ID))
+
+	if launch.SSHPassword == "" {
+		key, err := PublicKey(client, ui, launch.SSHPrivateKey)
+		if err != nil {
+			return h, err
+		}
+		if err := api.InstanceUpdatePublicKeys(client, instance.ID, []string{key.ID}); err != nil {
+			return h, err
+		}
+	}
+
+	ui.Say(fmt.Sprintf("Booting instance %s", h.ID))
+	if err := api.InstanceStart(ctx, client, h.ID, api.DEFAULT_TIMEOUT); err != nil {
+		return h, fmt.Errorf("Error starting instance %s: %w", h.ID, err)
+	}
+
+	ui.Say(fmt.Sprintf("Waiting for SSH on %s", ip.Address))
+	timeout := launch.SSHWaitTimeout
+	if timeout == 0 {
+		timeout = 5 * time.Minute
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		nc, err := ssh.ConnectFunc("tcp", ip.Address+":22")()
+		if err == nil {
+			nc.Close()
+			return h, nil
+		}
+		if time.Now().After(deadline) {
+			return h, fmt.Errorf("Timeout waiting for SSH on helper instance %s: %w", h.ID, err)
+		}
+		if err := api.Sleep(ctx, 5*time.Second); err != nil {
+			return h, err
+		}
+	}
+}
+
+// Destroy terminates a launched helper instance and releases its disk and
+// IP address, recording a leak for anything that can't be. Disks attached
+// to it are detached but otherwise left alone.
+func (h *HelperInstance) Destroy(state multistep.StateBag) {
+	if h.ID != "" {
+		TerminateInstance(state, h.ID)
+		h.ID = ""
+	}
+	if h.ipID != "" {
+		DeallocateIP(state, h.ipID)
+		h.ipID = ""
+	}
+	if h.diskID != "" {
+		DeleteDisk(state, h.diskID)
+		h.diskID = ""
+	}
+}
+
+// SSHClientConfig returns the config used to connect to a helper instance
+// or, by the vnc builder, to the instance being built
+func SSHClientConfig(username string, password string, privateKeyFile string) (*gossh.ClientConfig, error) {
+	auth := []gossh.AuthMethod{
+		gossh.Password(password),
+		gossh.KeyboardInteractive(
+			ssh.PasswordKeyboardInteractive(password)),
+	}
+
+	if privateKeyFile != "" {
+		signer, err := commonssh.FileSigner(privateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		auth = append(auth, gossh.PublicKeys(signer))
+	}
+
+	return &gossh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+	}, nil
+}
+
+// Attach attaches a disk to the helper, starting the helper if it is
+// stopped, and returns the device the disk appears as, e.g. /dev/xvdb
+func (h *HelperInstance) Attach(ctx context.Context, client *api.Client, ui packersdk.Ui, diskID string) (device string, err error) {
+	instance, err := api.InstanceInfo(client, h.ID)
+	if err != nil {
+		return "", fmt.Errorf("Error getting info for instance %s: %w", h.ID, err)
+	}
+
+	ui.Say(fmt.Sprintf("Attaching disk %s to instance %s", diskID, h.ID))
+	if err := api.InstanceAddDisk(ctx, client, h.ID, diskID); err != nil {
+		return "", fmt.Errorf("Error attaching disk %s to instance %s: %w", diskID, h.ID, err)
+	}
+	// Boot the helper if not already running
+	if instance.State == "stopped" {
+		ui.Say(fmt.Sprintf("Booting instance %s", h.ID))
+		if err := api.InstanceStart(ctx, client, h.ID, api.DEFAULT_TIMEOUT); err != nil {
+			return "", fmt.Errorf("Error starting instance %s: %w", h.ID, err)
+		}
+		h.booted = true
+		if err := api.Sleep(ctx, 30*time.Second); err != nil {
+			return "", err
+		}
+	}
+
+	// Get the disk position in the helper
+	instance, err = api.InstanceInfo(client, h.ID)
+	if err != nil {
+		return "", fmt.Errorf("Error getting info for instance %s: %w", h.ID, err)
+	}
+	for _, disk := range instance.Disks {
+		if disk.ID == diskID {
+			return h.device(ctx, client, disk.Position)
+		}
+	}
+	return "", fmt.Errorf("Couldn't find index of disk %s attached to instance %s", diskID, h.ID)
+}
+
+// device returns the device of the disk at position on the helper, e.g.
+// position 1 is /dev/xvdb under Xen, or /dev/vdb with virtio. The name
+// depends on the hypervisor's disk driver, so it is looked up in /sys/block
+// on the helper, waiting a little for a live attached disk to appear.
+func (h *HelperInstance) device(ctx context.Context, client *api.Client, position int) (string, error) {
+	comm, err := h.Connect(client, false)
+	if err != nil {
+		return "", err
+	}
+	letter := string(rune('a' + position))
+	var names []string
+	for attempt := 1; ; attempt++ {
+		stdout := new(bytes.Buffer)
+		stderr := new(bytes.Buffer)
+		cmd := &packersdk.RemoteCmd{Command: "ls /sys/block", Stdout: stdout, Stderr: stderr}
+		if err := comm.Start(ctx, cmd); err != nil {
+			return "", fmt.Errorf("Error listing block devices on instance %s: %w", h.ID, err)
+		}
+		if status := cmd.Wait(); status != 0 {
+			return "", fmt.Errorf("Error listing block devices on instance %s: exit status %d: %s", h.ID, status, stderr.String())
+		}
+		names = strings.Fields(stdout.String())
+		for _, prefix := range []string{"xvd", "vd", "sd"} {
+			for _, name := range names {
+				if name == prefix+letter {
+					return "/dev/" + name, nil
+				}
+			}
+		}
+		if attempt == helperDeviceAttempts {
+			break
+		}
+		if err := api.Sleep(ctx, 2*time.Second); err != nil {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("Couldn't find the device of the disk at position %d on instance %s, it has: %s", position, h.ID, strings.Join(names, " "))
+}
+
+// Restore stops the helper again if Attach had to boot it, leaving a
+// long-running helper as it was found
+func (h *HelperInstance) Restore(ctx context.Context, client *api.Client, ui packersdk.Ui) error {
+	if !h.booted {
+		return nil
+	}
+	ui.Say(fmt.Sprintf("Stopping instance %s again", h.ID))
+	if err := api.InstanceStop(ctx, client, h.ID, api.DEFAULT_TIMEOUT); err != nil {
+		return fmt.Errorf("Error stopping instance %s: %w", h.ID, err)
+	}
+	h.booted = false
+	return nil
+}
+
+// Detach live detaches a disk from the helper
+func (h *HelperInstance) Detach(ctx context.Context, client *api.Client, diskID string) error {
+	if err := api.InstanceRemoveDisk(ctx, client, h.ID, diskID); err != nil {
+		return fmt.Errorf("Error detaching disk %s from instance %s: %w", diskID, h.ID, err)
+	}
+	return nil
+}
+
+// Connect connects to the helper over SSH, at the first address of its
+// first network adapter. Commands that write binary data to stdout must
+// not have a pty.
+func (h *HelperInstance) Connect(client *api.Client, pty bool) (packersdk.Communicator, error) {
+	instance, err := api.InstanceInfo(client, h.ID)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting info for instance %s: %w", h.ID, err)
+	}
+	ip_address, err := instance.FirstIPAddress()
+	if err != nil {
+		return nil, err
+	}
+	ssh_address := ip_address + ":22"
+
+	// Check the port is reachable first, for a clearer error
+	connFunc := ssh.ConnectFunc("tcp", ssh_address)
+	nc, err := connFunc()
+	if err != nil {
+		return nil, fmt.Errorf("TCP connection to SSH ip/port failed: %w", err)
+	}
+	nc.Close()
+
+	comm, err := ssh.New(ssh_address, &ssh.Config{
+		Connection: connFunc,
+		SSHConfig:  h.SSHConfig,
+		Pty:        pty,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return comm, nil
+}
@@ -0,0 +1,90 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/thehypercloud/packer-hypercloud/api"
+)
+
+// LocationConfig is where a build runs: its performance tiers and network,
+// each given by id or name, and optionally the region to look names up in
+type LocationConfig struct {
+	Region                      string `mapstructure:"region"`
+	DiskPerformanceTierID       string `mapstructure:"disk_performance_tier_id"`
+	DiskPerformanceTierName     string `mapstructure:"disk_performance_tier_name"`
+	InstancePerformanceTierID   string `mapstructure:"instance_performance_tier_id"`
+	InstancePerformanceTierName string `mapstructure:"instance_performance_tier_name"`
+	NetworkID                   string `mapstructure:"network_id"`
+	NetworkName                 string `mapstructure:"network_name"`
+
+	regionID string
+}
+
+func (c *LocationConfig) Prepare() []error {
+	var errs []error
+	for _, option := range []struct{ name, id, byName string }{
+		{"disk_performance_tier", c.DiskPerformanceTierID, c.DiskPerformanceTierName},
+		{"instance_performance_tier", c.InstancePerformanceTierID, c.InstancePerformanceTierName},
+		{"network", c.NetworkID, c.NetworkName},
+	} {
+		if option.id == "" && option.byName == "" {
+			errs = append(errs, fmt.Errorf("%s_id or %s_name is required", option.name, option.name))
+		} else if option.id != "" && option.byName != "" {
+			errs = append(errs, fmt.Errorf("only one of %s_id or %s_name may be given", option.name, option.name))
+		}
+	}
+	return errs
+}
+
+// Resolve looks up the ids of the tiers and network given by name, and
+// returns the disk performance tier, whose region the build runs in and is
+// then given by RegionID
+func (c *LocationConfig) Resolve(client *api.Client) (*api.PerformanceTier, error) {
+	region := ""
+	if c.Region != "" {
+		r, err := api.FindRegion(client, c.Region)
+		if err != nil {
+			return nil, fmt.Errorf("Error finding region: %w", err)
+		}
+		region = r.ID
+	}
+
+	var tier *api.PerformanceTier
+	var err error
+	if c.DiskPerformanceTierID != "" {
+		tier, err = api.FindDiskTier(client, c.DiskPerformanceTierID)
+	} else {
+		tier, err = api.FindDiskTierByName(client, c.DiskPerformanceTierName, region)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if region != "" && tier.Region.ID != region {
+		return nil, fmt.Errorf("disk performance tier %s is in region %s, not %s", tier.ID, tier.Region.Name, c.Region)
+	}
+	c.DiskPerformanceTierID = tier.ID
+	c.regionID = tier.Region.ID
+	region = tier.Region.ID
+
+	if c.InstancePerformanceTierID == "" {
+		instanceTier, err := api.FindInstanceTierByName(client, c.InstancePerformanceTierName, region)
+		if err != nil {
+			return nil, err
+		}
+		c.InstancePerformanceTierID = instanceTier.ID
+	}
+
+	if c.NetworkID == "" {
+		network, err := api.FindNetworkByName(client, c.NetworkName, region)
+		if err != nil {
+			return nil, err
+		}
+		c.NetworkID = network.ID
+	}
+	return tier, nil
+}
+
+// RegionID is the id of the region the build runs in, once resolved
+func (c *LocationConfig) RegionID() string {
+	return c.regionID
+}
@@ -0,0 +1,11 @@
+package common
+
+// Prefixes of the names given to resources while a build runs. The
+// finished disk is renamed, so anything still named with one of these
+// prefixes was either created by a running build or left behind by one
+// that crashed.
+const (
+	InProgressDiskPrefix  = "Packer in-progress: "
+	BuildResourcePrefix   = "Packer: "
+	DownloadingDiskPrefix = "Downloading... "
+)
@@ -0,0 +1,153 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/thehypercloud/packer-hypercloud/api"
+)
+
+// PreflightConfig turns on checking in Prepare that a build's HyperCloud
+// resources exist and fit together, before any are created
+type PreflightConfig struct {
+	Preflight bool `mapstructure:"preflight"`
+}
+
+// Preflight collects every problem found with a build's resources, so
+// that they can be reported at once
+type Preflight struct {
+	Client *api.Client
+	Errors []error
+}
+
+func (p *Preflight) errorf(format string, args ...interface{}) {
+	p.Errors = append(p.Errors, fmt.Errorf("preflight: "+format, args...))
+}
+
+// Connect checks the client can authenticate, which every other check
+// needs
+func (p *Preflight) Connect() bool {
+	if _, err := api.ListRegions(p.Client); err != nil {
+		p.errorf("couldn't connect to HyperCloud: %s", err)
+		return false
+	}
+	return true
+}
+
+// Location checks the tiers and network exist, are in the same region, and
+// that the network has an address free. It returns the region, or "" if
+// the disk performance tier couldn't be found.
+func (p *Preflight) Location(c *LocationConfig) string {
+	region := ""
+	if c.Region != "" {
+		r, err := api.FindRegion(p.Client, c.Region)
+		if err != nil {
+			p.errorf("%s", err)
+			return ""
+		}
+		region = r.ID
+	}
+
+	var tier *api.PerformanceTier
+	var err error
+	if c.DiskPerformanceTierID != "" {
+		tier, err = api.FindDiskTier(p.Client, c.DiskPerformanceTierID)
+	} else {
+		tier, err = api.FindDiskTierByName(p.Client, c.DiskPerformanceTierName, region)
+	}
+	if err != nil {
+		p.errorf("%s", err)
+		return ""
+	}
+	if region != "" && tier.Region.ID != region {
+		p.errorf("disk performance tier %s is in region %s, not %s", tier.ID, tier.Region.Name, c.Region)
+	}
+	region = tier.Region.ID
+
+	if c.InstancePerformanceTierID != "" {
+		p.instanceTier(c.InstancePerformanceTierID, tier.Region)
+	} else if _, err := api.FindInstanceTierByName(p.Client, c.InstancePerformanceTierName, region); err != nil {
+		p.errorf("%s", err)
+	}
+
+	var network *api.Network
+	if c.NetworkID != "" {
+		network, err = api.NetworkInfo(p.Client, c.NetworkID)
+		if err == nil && network.Region.ID != "" && network.Region.ID != region {
+			p.errorf("network %s is in region %s, but disk performance tier %s is in region %s",
+				network.ID, network.Region.Name, tier.ID, tier.Region.Name)
+		}
+	} else {
+		network, err = api.FindNetworkByName(p.Client, c.NetworkName, region)
+	}
+	if err != nil {
+		p.errorf("%s", err)
+	} else {
+		p.freeAddress(network)
+	}
+	return region
+}
+
+func (p *Preflight) instanceTier(id string, region api.Region) {
+	tiers, err := api.ListInstanceTiers(p.Client)
+	if err != nil {
+		p.errorf("%s", err)
+		return
+	}
+	for i := range tiers {
+		if tiers[i].ID == id {
+			if tiers[i].Region.ID != region.ID {
+				p.errorf("instance performance tier %s is in region %s, but the disk performance tier is in region %s",
+					id, tiers[i].Region.Name, region.Name)
+			}
+			return
+		}
+	}
+	p.errorf("No instance tier with id %s was found", id)
+}
+
+func (p *Preflight) freeAddress(network *api.Network) {
+	hosts, err := network.HostCount()
+	if err != nil {
+		p.errorf("%s", err)
+		return
+	}
+	ips, err := api.IPAddressList(p.Client)
+	if err != nil {
+		p.errorf("%s", err)
+		return
+	}
+	used := 0
+	for i := range ips {
+		if ips[i].Network == network.ID {
+			used++
+		}
+	}
+	if used >= hosts {
+		p.errorf("network %s has no free IP addresses: %d of %d are allocated", network.ID, used, hosts)
+	}
+}
+
+// Template checks a template exists in the region, and that its disk is
+// no larger than diskSize GB, unless diskSize is 0
+func (p *Preflight) Template(what string, source TemplateSource, region string, diskSize uint) {
+	template, err := source.Find(p.Client, region)
+	if err != nil {
+		p.errorf("%s: %s", what, err)
+		return
+	}
+	if diskSize != 0 && template.Size > diskSize {
+		p.errorf("%s %s has a %d GB disk, larger than disk_size %d GB", what, template.ID, template.Size, diskSize)
+	}
+}
+
+// Instance checks an instance exists and has an IP address to connect to
+func (p *Preflight) Instance(what string, id string) {
+	instance, err := api.InstanceInfo(p.Client, id)
+	if err != nil {
+		p.errorf("%s: %s", what, err)
+		return
+	}
+	if _, err := instance.FirstIPAddress(); err != nil {
+		p.errorf("%s %s: %s", what, id, err)
+	}
+}
@@ -0,0 +1,41 @@
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/thehypercloud/packer-hypercloud/api"
+)
+
+// PublicKey returns the HyperCloud public key matching the .pub file next
+// to privateKeyFile, adding it if it isn't in the system yet
+func PublicKey(client *api.Client, ui packersdk.Ui, privateKeyFile string) (*api.PublicKey, error) {
+	pubKeyPath := privateKeyFile + ".pub"
+	if _, err := os.Stat(pubKeyPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("SSH public key file does not exist: %s", pubKeyPath)
+	}
+
+	publicKeyData, err := ioutil.ReadFile(pubKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	publicKeyContents := strings.TrimSpace(string(publicKeyData))
+
+	keys, err := api.ListPublicKeys(client)
+	if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		if strings.TrimSpace(keys[i].Key) == publicKeyContents {
+			ui.Say("Public key already in system (matched by key content)")
+			return &keys[i], nil
+		}
+	}
+
+	ui.Say("Public key not found. Creating.")
+	return api.PublicKeyCreate(client, "packer-"+filepath.Base(privateKeyFile), publicKeyContents)
+}
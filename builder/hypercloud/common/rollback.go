@@ -0,0 +1,118 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/thehypercloud/packer-hypercloud/api"
+)
+
+const stateLeaks = "hypercloud_leaks"
+
+// Leak is a resource that could not be deleted while rolling back a build
+type Leak struct {
+	Kind string
+	ID   string
+	Err  error
+}
+
+// Halted reports whether the build failed or was cancelled, in which case
+// each step's Cleanup should roll back what it created.
+func Halted(state multistep.StateBag) bool {
+	_, cancelled := state.GetOk(multistep.StateCancelled)
+	_, halted := state.GetOk(multistep.StateHalted)
+	return cancelled || halted
+}
+
+// RecordLeak notes a resource that could not be deleted, to be listed by
+// ReportLeaks at the end of the build.
+func RecordLeak(state multistep.StateBag, kind string, id string, err error) {
+	var leaks []Leak
+	if raw, ok := state.GetOk(stateLeaks); ok {
+		leaks = raw.([]Leak)
+	}
+	state.Put(stateLeaks, append(leaks, Leak{Kind: kind, ID: id, Err: err}))
+}
+
+// ReportLeaks tells the user about every resource that was left behind,
+// either because rollback failed or because the build was aborted. onError
+// is the build's packer_on_error.
+func ReportLeaks(ui packersdk.Ui, state multistep.StateBag, onError string) {
+	if Aborted(state, onError) {
+		ui.Error("Build aborted: the disks, IP addresses and instances it created have not been deleted.")
+	}
+
+	raw, ok := state.GetOk(stateLeaks)
+	if !ok {
+		return
+	}
+	leaks := raw.([]Leak)
+	if len(leaks) == 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("The following resources could not be cleaned up and must be deleted manually:")
+	for _, leak := range leaks {
+		fmt.Fprintf(&buf, "\n  %s %s: %s", leak.Kind, leak.ID, leak.Err)
+	}
+	ui.Error(buf.String())
+}
+
+// cleanupClient returns the build's client with retries that are not
+// cancelled along with the build, so that rollback after an interrupt
+// still gets the chance to succeed.
+func cleanupClient(state multistep.StateBag) *api.Client {
+	return state.Get("client").(*api.Client).WithContext(context.Background())
+}
+
+// DeleteDisk deletes a disk created by the build, recording a leak if it
+// fails.
+func DeleteDisk(state multistep.StateBag, id string) {
+	ui := state.Get("ui").(packersdk.Ui)
+	ui.Say(fmt.Sprintf("Deleting disk %s", id))
+	if err := api.DiskDelete(cleanupClient(state), id); err != nil && !api.IsNotFound(err) {
+		ui.Error(fmt.Sprintf("Error deleting disk %s: %s", id, err))
+		RecordLeak(state, "disk", id, err)
+	}
+}
+
+// DeallocateIP releases an ip address allocated by the build, recording a
+// leak if it fails.
+func DeallocateIP(state multistep.StateBag, id string) {
+	ui := state.Get("ui").(packersdk.Ui)
+	ui.Say(fmt.Sprintf("Deallocating IP address %s", id))
+	if err := api.DeallocateIP(cleanupClient(state), id); err != nil && !api.IsNotFound(err) {
+		ui.Error(fmt.Sprintf("Error deallocating IP address %s: %s", id, err))
+		RecordLeak(state, "ip address", id, err)
+	}
+}
+
+// TerminateInstance detaches the disks and ip addresses of an instance
+// created by the build, so that the steps which created them can roll them
+// back, then terminates it and waits for it to go. A failure is recorded
+// as a leak.
+func TerminateInstance(state multistep.StateBag, id string) {
+	client := cleanupClient(state)
+	ctx := context.Background()
+	ui := state.Get("ui").(packersdk.Ui)
+
+	ui.Say(fmt.Sprintf("Terminating instance %s", id))
+	if err := api.InstanceUpdateDisks(ctx, client, id, make([]string, 0)); err != nil {
+		if api.IsNotFound(err) {
+			return
+		}
+		ui.Error(fmt.Sprintf("Error removing disks from instance %s: %s", id, err))
+	}
+	if err := api.InstanceRemoveNetworks(client, id); err != nil {
+		ui.Error(fmt.Sprintf("Error removing networks from instance %s: %s", id, err))
+	}
+	err := api.InstanceTerminate(ctx, client, id, api.DEFAULT_TIMEOUT, true)
+	if err != nil && !api.IsNotFound(err) {
+		ui.Error(fmt.Sprintf("Error terminating instance %s: %s", id, err))
+		RecordLeak(state, "instance", id, err)
+	}
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// RunConfig is the size of the builder instance and its disk, and how the
+// instance is booted and shut down
+type RunConfig struct {
+	DiskSize           uint   `mapstructure:"disk_size"`
+	Memory             uint   `mapstructure:"memory"`
+	RawBootWait        string `mapstructure:"boot_wait"`
+	ShutdownCommand    string `mapstructure:"shutdown_command"`
+	RawShutdownTimeout string `mapstructure:"shutdown_timeout"`
+	ShutdownFromAPI    bool   `mapstructure:"shutdown_from_api"`
+
+	bootWait        time.Duration
+	shutdownTimeout time.Duration
+}
+
+// Prepare sets the defaults and parses the durations. boot_wait defaults to
+// none; a builder with a different default sets it first.
+func (c *RunConfig) Prepare() []error {
+	var errs []error
+
+	if c.DiskSize == 0 {
+		c.DiskSize = 10
+	}
+	if c.Memory == 0 {
+		c.Memory = 512
+	}
+	if c.RawShutdownTimeout == "" {
+		c.RawShutdownTimeout = "5m"
+	}
+
+	if c.RawBootWait != "" {
+		wait, err := time.ParseDuration(c.RawBootWait)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Failed parsing boot_wait: %s", err))
+		}
+		c.bootWait = wait
+	}
+	timeout, err := time.ParseDuration(c.RawShutdownTimeout)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("Failed parsing shutdown_timeout: %s", err))
+	}
+	c.shutdownTimeout = timeout
+
+	if c.ShutdownCommand != "" && c.ShutdownFromAPI {
+		errs = append(errs, fmt.Errorf("only one of shutdown_command or shutdown_from_api may be given"))
+	}
+	return errs
+}
@@ -0,0 +1,41 @@
+// Package common contains the pieces shared by the HyperCloud builders
+package common
+
+import (
+	"errors"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+// RunError returns why the steps of a build didn't all complete, or nil if
+// they did
+func RunError(state multistep.StateBag) error {
+	if rawErr, ok := state.GetOk("error"); ok {
+		return rawErr.(error)
+	}
+	if _, ok := state.GetOk(multistep.StateCancelled); ok {
+		return errors.New("Build was cancelled.")
+	}
+	if _, ok := state.GetOk(multistep.StateHalted); ok {
+		return errors.New("Build was halted.")
+	}
+	return nil
+}
+
+// Aborted reports whether the runner from commonsteps.NewRunner skipped
+// rolling back a failed or interrupted build, because of -on-error=abort or
+// run-cleanup-provisioner, or an "abort" answer to -on-error=ask. onError is
+// the build's packer_on_error.
+func Aborted(state multistep.StateBag, onError string) bool {
+	if !Halted(state) {
+		return false
+	}
+	switch onError {
+	case "abort", "run-cleanup-provisioner":
+		return true
+	case "ask":
+		_, ok := state.GetOk("aborted")
+		return ok
+	}
+	return false
+}
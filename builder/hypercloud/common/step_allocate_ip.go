@@ -0,0 +1,50 @@
+package common
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/thehypercloud/packer-hypercloud/api"
+)
+
+// StepAllocateIP allocates an IP address on the build's network, to be
+// attached to the builder instance. It is put in the state bag as "ip".
+type StepAllocateIP struct {
+	Location  *LocationConfig
+	BuildName string
+	Tags      api.Tags
+}
+
+func (s *StepAllocateIP) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*api.Client)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	ui.Say("Allocating IP address")
+	ip, err := api.AllocateIP(client, s.Location.NetworkID, BuildResourcePrefix+s.BuildName, s.Tags)
+	if err != nil {
+		err := fmt.Errorf("Error allocating IP via api: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	ui.Say(fmt.Sprintf("Allocated ip %s", ip.Address))
+	state.Put("ip", ip)
+	return multistep.ActionContinue
+}
+
+func (s *StepAllocateIP) Cleanup(state multistep.StateBag) {
+	if !Halted(state) {
+		return
+	}
+	if ip, ok := state.GetOk("ip"); ok {
+		DeallocateIP(state, ip.(*api.IPAddress).ID)
+	}
+}
+
+// CommHost returns the address of the builder instance, for the
+// communicator to connect to
+func CommHost(state multistep.StateBag) (string, error) {
+	return state.Get("ip").(*api.IPAddress).Address, nil
+}
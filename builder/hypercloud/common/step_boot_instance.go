@@ -0,0 +1,55 @@
+package common
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/thehypercloud/packer-hypercloud/api"
+)
+
+// StepBootInstance boots the instance, waits for its state to be
+// 'running', and then for boot_wait
+type StepBootInstance struct {
+	Config *RunConfig
+}
+
+func (s *StepBootInstance) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*api.Client)
+	ui := state.Get("ui").(packersdk.Ui)
+	instance := state.Get("instance").(*api.Instance)
+
+	ui.Say("Booting instance...")
+	err := api.InstanceStart(ctx, client, instance.ID, api.DEFAULT_TIMEOUT)
+	if err != nil {
+		err := fmt.Errorf("Error booting instance: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if s.Config.bootWait > 0 {
+		ui.Say(fmt.Sprintf("Waiting %s for boot...", s.Config.bootWait))
+		if err := api.Sleep(ctx, s.Config.bootWait); err != nil {
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *StepBootInstance) Cleanup(state multistep.StateBag) {
+	client := state.Get("client").(*api.Client)
+	raw, ok := state.GetOk("instance")
+	if !ok {
+		// Deleted by StepCleanup
+		return
+	}
+	instance, err := api.InstanceInfo(client, raw.(*api.Instance).ID)
+	if err == nil && instance.State == "running" {
+		api.InstanceStop(context.Background(), client, instance.ID, api.DEFAULT_TIMEOUT)
+	}
+}
@@ -0,0 +1,61 @@
+package common
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/thehypercloud/packer-hypercloud/api"
+)
+
+// StepBuildInstance creates the builder instance with the disks named by
+// DiskKeys in the state bag, in that order, and the IP address. It boots
+// from BootDevice, "disk" or "cdrom", and is put in the state bag as
+// "instance".
+type StepBuildInstance struct {
+	Config     *RunConfig
+	Location   *LocationConfig
+	BuildName  string
+	Tags       api.Tags
+	DiskKeys   []string
+	BootDevice string
+}
+
+func (s *StepBuildInstance) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*api.Client)
+	ui := state.Get("ui").(packersdk.Ui)
+	ip := state.Get("ip").(*api.IPAddress)
+
+	var diskids []string
+	for _, key := range s.DiskKeys {
+		diskids = append(diskids, state.Get(key).(*api.Disk).ID)
+	}
+	ipids := []string{
+		ip.ID,
+	}
+
+	ui.Say("Creating instance...")
+	instance, err := api.InstanceCreate(client, BuildResourcePrefix+s.BuildName, s.Config.Memory,
+		s.Location.InstancePerformanceTierID, s.Location.RegionID(), diskids, ipids, s.BootDevice, s.Tags)
+	if err != nil {
+		err := fmt.Errorf("Error creating instance: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	ui.Say(fmt.Sprintf("Instance created with ID: %s", instance.ID))
+	state.Put("instance", instance)
+	return multistep.ActionContinue
+}
+
+// Terminate the instance if the build failed, releasing its disks and IP
+// address to be rolled back by the steps that created them.
+func (s *StepBuildInstance) Cleanup(state multistep.StateBag) {
+	if !Halted(state) {
+		return
+	}
+	if instance, ok := state.GetOk("instance"); ok {
+		TerminateInstance(state, instance.(*api.Instance).ID)
+	}
+}
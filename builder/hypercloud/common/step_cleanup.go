@@ -0,0 +1,54 @@
+package common
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/thehypercloud/packer-hypercloud/api"
+)
+
+// StepCleanup deletes the builder instance and its IP address once the
+// build has succeeded, leaving its disks
+type StepCleanup struct{}
+
+func (s *StepCleanup) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*api.Client)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	ip := state.Get("ip").(*api.IPAddress)
+	instance := state.Get("instance").(*api.Instance)
+	instanceId := instance.ID
+
+	ui.Say("Deleting build instance...")
+
+	err := api.InstanceUpdateDisks(ctx, client, instanceId, make([]string, 0))
+	if err != nil {
+		ui.Error(fmt.Errorf("Error removing disks from instance: %s", err).Error())
+	}
+	err = api.InstanceRemoveNetworks(client, instanceId)
+	if err != nil {
+		ui.Error(fmt.Errorf("Error removing ips from instance: %s", err).Error())
+	}
+	ui.Say("Deallocating IP")
+	err = api.DeallocateIP(client, ip.ID)
+	if err != nil && !api.IsNotFound(err) {
+		ui.Error(fmt.Errorf("Error deleting IP: %s", err).Error())
+		RecordLeak(state, "ip address", ip.ID, err)
+	}
+	// Whether released or recorded as leaked, the address is done with, so
+	// a later step halting doesn't have it cleaned up or reported again
+	state.Remove("ip")
+	err = api.InstanceTerminate(ctx, client, instanceId, api.DEFAULT_TIMEOUT, false)
+	if err != nil && !api.IsNotFound(err) {
+		ui.Error(fmt.Errorf("Error deleting instance: %s", err).Error())
+		RecordLeak(state, "instance", instanceId, err)
+	}
+	state.Remove("instance")
+
+	// Since the build actually succeeded, none of these errors are deal-breakers
+	return multistep.ActionContinue
+}
+
+func (s *StepCleanup) Cleanup(state multistep.StateBag) {}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/thehypercloud/packer-hypercloud/api"
+	"github.com/thehypercloud/packer-hypercloud/api/hypercloudtest"
+)
+
+func TestStepCleanupNotRolledBackAgain(t *testing.T) {
+	srv := hypercloudtest.NewServer()
+	defer srv.Close()
+	f := srv.Seed()
+	client := srv.Client()
+
+	ip, err := api.AllocateIP(client, f.NetworkID, "build", nil)
+	if err != nil {
+		t.Fatalf("AllocateIP: %s", err)
+	}
+	instanceID := srv.AddInstance(f.RegionID, "build", "stopped")
+
+	state := new(multistep.BasicStateBag)
+	state.Put("client", client)
+	state.Put("ui", packersdk.TestUi(t))
+	state.Put("ip", ip)
+	state.Put("instance", &api.Instance{ID: instanceID})
+
+	if action := new(StepCleanup).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("StepCleanup returned %v", action)
+	}
+
+	// A later step halts the build, and the earlier steps clean up
+	state.Put(multistep.StateHalted, true)
+	new(StepBootInstance).Cleanup(state)
+	new(StepBuildInstance).Cleanup(state)
+	new(StepAllocateIP).Cleanup(state)
+
+	if leaks, ok := state.GetOk(stateLeaks); ok {
+		t.Errorf("recorded leaks %v", leaks)
+	}
+	deletes := 0
+	for _, r := range srv.Requests() {
+		if strings.HasPrefix(r, "DELETE ") {
+			deletes++
+		}
+	}
+	if deletes != 2 {
+		t.Errorf("sent %d deletes, expected one each for the instance and ip address: %v", deletes, srv.Requests())
+	}
+}
@@ -0,0 +1,45 @@
+package common
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/thehypercloud/packer-hypercloud/api"
+)
+
+// StepNameDisk renames and tags the finished disk in the state bag, which
+// it replaces with the updated disk. It runs before StepPublishTemplate so
+// that templates are published from disks that are already named.
+type StepNameDisk struct {
+	Config    *ArtifactNameConfig
+	Ctx       *interpolate.Context
+	BuildName string
+	Tags      api.Tags
+	// SourceName returns the name of the template or disk the build
+	// started from, for {{.SourceTemplate}}
+	SourceName func(state multistep.StateBag) string
+}
+
+func (s *StepNameDisk) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*api.Client)
+	ui := state.Get("ui").(packersdk.Ui)
+	disk := state.Get("disk").(*api.Disk)
+
+	ui.Say(fmt.Sprintf("Naming disk %s", disk.ID))
+	renamed, err := s.Config.NameDisk(client, disk, *s.Ctx, ArtifactNameData{
+		BuildName:      s.BuildName,
+		SourceTemplate: s.SourceName(state),
+	}, s.Tags)
+	if err != nil {
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	state.Put("disk", renamed)
+	return multistep.ActionContinue
+}
+
+func (s *StepNameDisk) Cleanup(state multistep.StateBag) {}
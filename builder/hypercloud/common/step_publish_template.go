@@ -0,0 +1,78 @@
+package common
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/thehypercloud/packer-hypercloud/api"
+)
+
+// PublishConfig is squashed into each builder's Config. When a template
+// name is given, the finished disk is published as a template.
+type PublishConfig struct {
+	PublishTemplateName string `mapstructure:"publish_template_name"`
+	PublishTemplateSlug string `mapstructure:"publish_template_slug"`
+}
+
+func (c *PublishConfig) Prepare() []error {
+	if c.PublishTemplateSlug != "" && c.PublishTemplateName == "" {
+		return []error{fmt.Errorf("publish_template_name is required when publish_template_slug is set")}
+	}
+	return nil
+}
+
+// Publishing reports whether the build publishes a template
+func (c *PublishConfig) Publishing() bool {
+	return c.PublishTemplateName != ""
+}
+
+// StepPublishTemplate publishes the disk in the state bag as a template,
+// at the next version after any existing template with the same slug, or
+// name if there is no slug. The template is put in the state bag as
+// "template_published".
+type StepPublishTemplate struct {
+	Config *PublishConfig
+	Tags   api.Tags
+}
+
+func (s *StepPublishTemplate) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	if !s.Config.Publishing() {
+		return multistep.ActionContinue
+	}
+	client := state.Get("client").(*api.Client)
+	ui := state.Get("ui").(packersdk.Ui)
+	disk := state.Get("disk").(*api.Disk)
+
+	ui.Say(fmt.Sprintf("Publishing disk %s as template %s", disk.ID, s.Config.PublishTemplateName))
+	template, err := api.TemplateCreate(client, disk.ID, disk.Region.ID,
+		s.Config.PublishTemplateName, s.Config.PublishTemplateSlug, s.Tags)
+	if err != nil {
+		err := fmt.Errorf("Error publishing template: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	ui.Say(fmt.Sprintf("Published template %s version %d with ID: %s", template.Name, template.Version, template.ID))
+	state.Put("template_published", template)
+	return multistep.ActionContinue
+}
+
+// Delete the template if the build was cancelled after it was published
+func (s *StepPublishTemplate) Cleanup(state multistep.StateBag) {
+	if !Halted(state) {
+		return
+	}
+	raw, ok := state.GetOk("template_published")
+	if !ok {
+		return
+	}
+	template := raw.(*api.Template)
+	ui := state.Get("ui").(packersdk.Ui)
+	ui.Say(fmt.Sprintf("Deleting template %s", template.ID))
+	if err := api.TemplateDelete(cleanupClient(state), template.ID); err != nil && !api.IsNotFound(err) {
+		ui.Error(fmt.Sprintf("Error deleting template %s: %s", template.ID, err))
+		RecordLeak(state, "template", template.ID, err)
+	}
+}
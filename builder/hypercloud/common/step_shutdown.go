@@ -0,0 +1,73 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/thehypercloud/packer-hypercloud/api"
+)
+
+// StepShutdown stops the instance. With shutdown_command it is run over
+// the communicator, and with neither that nor shutdown_from_api the guest
+// is expected to power itself off, e.g. from its last provisioner. Either
+// way the instance is stopped through the API if it hasn't stopped within
+// shutdown_timeout.
+type StepShutdown struct {
+	Config *RunConfig
+}
+
+func (s *StepShutdown) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*api.Client)
+	ui := state.Get("ui").(packersdk.Ui)
+	instanceId := state.Get("instance").(*api.Instance).ID
+
+	instance, err := api.InstanceInfo(client, instanceId)
+	if err != nil {
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	if instance.State != "running" {
+		log.Printf("Instance is already %s", instance.State)
+		return multistep.ActionContinue
+	}
+
+	if !s.Config.ShutdownFromAPI {
+		if s.Config.ShutdownCommand != "" {
+			comm := state.Get("communicator").(packersdk.Communicator)
+			ui.Say("Gracefully halting virtual machine...")
+			log.Printf("Executing shutdown command: %s", s.Config.ShutdownCommand)
+			cmd := &packersdk.RemoteCmd{Command: s.Config.ShutdownCommand}
+			if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+				err := fmt.Errorf("Failed to send shutdown command: %s", err)
+				state.Put("error", err)
+				ui.Error(err.Error())
+				return multistep.ActionHalt
+			}
+		} else {
+			ui.Say("Waiting for instance to shutdown...")
+		}
+
+		log.Printf("Waiting max %s for shutdown to complete", s.Config.shutdownTimeout)
+		if err := api.InstanceWaitForState(ctx, client, instanceId, "stopped", s.Config.shutdownTimeout); err == nil {
+			log.Println("VM shut down.")
+			return multistep.ActionContinue
+		}
+		ui.Say("Instance did not shutdown in time. Sending API shutdown message as well")
+	} else {
+		ui.Say("Shutting down via the API")
+	}
+
+	if err := api.InstanceStop(ctx, client, instanceId, api.DEFAULT_TIMEOUT); err != nil {
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	log.Println("VM shut down.")
+	return multistep.ActionContinue
+}
+
+func (s *StepShutdown) Cleanup(state multistep.StateBag) {}
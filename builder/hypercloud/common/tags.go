@@ -0,0 +1,72 @@
+package common
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/uuid"
+	"github.com/thehypercloud/packer-hypercloud/api"
+)
+
+// Keys of the tags set on everything a build creates
+const (
+	TagBuildName = "packer_build_name"
+	TagBuildUUID = "packer_build_uuid"
+	TagSource    = "packer_source"
+	TagGitSHA    = "packer_git_sha"
+	TagArtifact  = "packer_artifact"
+)
+
+// TagConfig is squashed into each builder's Config for the user's tags
+type TagConfig struct {
+	Tags map[string]string `mapstructure:"tags"`
+
+	buildTags api.Tags
+}
+
+// Prepare validates the user's tags and works out the full set of tags for
+// the build: the user's, plus the build's name, a UUID unique to this run,
+// the source the image is built from and, when Packer is run from a git
+// checkout, the commit it is at.
+func (c *TagConfig) Prepare(buildName string, source string) []error {
+	var errs []error
+	for key := range c.Tags {
+		if strings.TrimSpace(key) == "" {
+			errs = append(errs, fmt.Errorf("tags must not have an empty key"))
+		} else if strings.HasPrefix(key, "packer_") {
+			errs = append(errs, fmt.Errorf("tag %q is reserved: keys starting packer_ are set by the builder", key))
+		}
+	}
+
+	c.buildTags = api.Tags(c.Tags).Merge(api.Tags{
+		TagBuildName: buildName,
+		TagBuildUUID: uuid.TimeOrderedUUID(),
+		TagSource:    source,
+	})
+	if sha := gitSHA(); sha != "" {
+		c.buildTags[TagGitSHA] = sha
+	}
+	return errs
+}
+
+// BuildTags returns the tags for resources created by the build
+func (c *TagConfig) BuildTags() api.Tags {
+	return c.buildTags
+}
+
+// ArtifactTags returns the tags for the finished disk, which mark it as the
+// build's artifact rather than something left behind
+func (c *TagConfig) ArtifactTags() api.Tags {
+	return c.buildTags.Merge(api.Tags{TagArtifact: "true"})
+}
+
+// gitSHA returns the commit of the git checkout Packer is being run from,
+// or "" if it isn't being run from one
+func gitSHA() string {
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
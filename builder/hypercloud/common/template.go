@@ -0,0 +1,51 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/thehypercloud/packer-hypercloud/api"
+)
+
+// TemplateSource names a template to create disks from, by one of its id,
+// slug or name
+type TemplateSource struct {
+	ID   string
+	Slug string
+	Name string
+}
+
+// Given returns the number of ways the template is named, which must be
+// exactly one for Find to be unambiguous
+func (t TemplateSource) Given() int {
+	n := 0
+	for _, s := range []string{t.ID, t.Slug, t.Name} {
+		if s != "" {
+			n++
+		}
+	}
+	return n
+}
+
+func (t TemplateSource) String() string {
+	return t.ID + t.Slug + t.Name
+}
+
+// Find returns the template in the region, taking the newest version of
+// a template named by slug or name
+func (t TemplateSource) Find(client *api.Client, region string) (*api.Template, error) {
+	templates, err := api.ListTemplates(client)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(api.ByVersionDesc(templates))
+	for i := range templates {
+		c := &templates[i]
+		if region == c.Region.ID && (t.ID == c.ID ||
+			(t.Slug != "" && t.Slug == c.Slug) ||
+			(t.Name != "" && t.Name == c.Name)) {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("Could not find template: %s", t)
+}
@@ -0,0 +1,71 @@
+package vnc
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/thehypercloud/packer-hypercloud/api"
+	hccommon "github.com/thehypercloud/packer-hypercloud/builder/hypercloud/common"
+)
+
+// Boot disks are cached between builds, named with a checksum of their
+// contents. While one is being transferred, its disk is named with the
+// DownloadingDiskPrefix and the same checksum, which claims it: other
+// builds wanting the same ISO wait for it rather than transferring it
+// again. Should two builds claim it at once, the older disk wins and the
+// other build deletes its own and waits.
+
+// errClaimLost is returned by transfer when another build claimed the same
+// boot disk first
+var errClaimLost = errors.New("another build claimed the boot disk first")
+
+// cachedBootDisk returns a completed boot disk with any of the build's
+// checksums in its name, trying the strongest checksum first
+func cachedBootDisk(disks []api.Disk, config *Config) (*api.Disk, *checksum) {
+	for i := range config.checksums {
+		sum := &config.checksums[i]
+		for j := range disks {
+			name := strings.ToLower(disks[j].Name)
+			if disks[j].Region.ID == config.RegionID() && !strings.HasPrefix(disks[j].Name, hccommon.DownloadingDiskPrefix) &&
+				strings.Contains(name, sum.String()) {
+				return &disks[j], sum
+			}
+		}
+	}
+	return nil, nil
+}
+
+// bootDiskClaims returns the disks the build's boot disk is being
+// transferred to, oldest first. The first is the one that wins.
+func bootDiskClaims(disks []api.Disk, config *Config) []api.Disk {
+	var claims []api.Disk
+	for i := range disks {
+		if disks[i].Region.ID != config.RegionID() || !strings.HasPrefix(disks[i].Name, hccommon.DownloadingDiskPrefix) {
+			continue
+		}
+		name := strings.ToLower(disks[i].Name)
+		for _, sum := range config.checksums {
+			if strings.Contains(name, sum.String()) {
+				claims = append(claims, disks[i])
+				break
+			}
+		}
+	}
+	sort.Sort(byClaimOrder(claims))
+	return claims
+}
+
+// byClaimOrder sorts disks by when they were created, then by ID so that
+// every build agrees on the order of disks created at the same time
+type byClaimOrder []api.Disk
+
+func (s byClaimOrder) Len() int      { return len(s) }
+func (s byClaimOrder) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byClaimOrder) Less(i, j int) bool {
+	a, b := s[i].CreatedAt.Time, s[j].CreatedAt.Time
+	if !a.Equal(b) {
+		return a.Before(b)
+	}
+	return s[i].ID < s[j].ID
+}
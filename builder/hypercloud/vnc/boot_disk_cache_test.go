@@ -0,0 +1,133 @@
+package vnc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/thehypercloud/packer-hypercloud/api"
+	hccommon "github.com/thehypercloud/packer-hypercloud/builder/hypercloud/common"
+)
+
+func testDisk(id string, name string, created time.Time) api.Disk {
+	return api.Disk{ID: id, Name: name, CreatedAt: api.Timestamp{Time: created}}
+}
+
+func diskIDs(disks []api.Disk) []string {
+	var ids []string
+	for _, disk := range disks {
+		ids = append(ids, disk.ID)
+	}
+	return ids
+}
+
+func TestBootDiskClaims(t *testing.T) {
+	sha256 := checksum{"sha256", testSHA256}
+	md5 := checksum{"md5", testMD5}
+	config := &Config{checksums: []checksum{sha256, md5}}
+
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Second)
+	downloading := hccommon.DownloadingDiskPrefix + "ubuntu.iso "
+
+	for _, tc := range []struct {
+		name  string
+		disks []api.Disk
+		want  []string
+	}{
+		{"none", nil, nil},
+		{
+			"oldest first",
+			[]api.Disk{
+				testDisk("c", downloading+sha256.String(), t1),
+				testDisk("a", downloading+sha256.String(), t0),
+			},
+			[]string{"a", "c"},
+		},
+		{
+			"same time by id",
+			[]api.Disk{
+				testDisk("b", downloading+sha256.String(), t0),
+				testDisk("a", downloading+md5.String(), t0),
+				testDisk("c", downloading+sha256.String(), t0),
+			},
+			[]string{"a", "b", "c"},
+		},
+		{
+			"unknown creation time first",
+			[]api.Disk{
+				testDisk("a", downloading+sha256.String(), t0),
+				testDisk("b", downloading+sha256.String(), time.Time{}),
+			},
+			[]string{"b", "a"},
+		},
+		{
+			"other checksums and cached disks ignored",
+			[]api.Disk{
+				testDisk("a", downloading+"sha256="+testMD5, t0),
+				testDisk("b", "ubuntu.iso "+sha256.String(), t0),
+				testDisk("c", downloading+"SHA256="+testSHA256, t1),
+			},
+			[]string{"c"},
+		},
+		{
+			"other regions ignored",
+			[]api.Disk{
+				{ID: "a", Name: downloading + sha256.String(), Region: api.Region{ID: "elsewhere"}},
+				testDisk("b", downloading+sha256.String(), t1),
+			},
+			[]string{"b"},
+		},
+	} {
+		if got := diskIDs(bootDiskClaims(tc.disks, config)); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: claims = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCachedBootDisk(t *testing.T) {
+	sha256 := checksum{"sha256", testSHA256}
+	md5 := checksum{"md5", testMD5}
+	config := &Config{checksums: []checksum{sha256, md5}}
+
+	for _, tc := range []struct {
+		name  string
+		disks []api.Disk
+		want  string
+		sum   *checksum
+	}{
+		{"none", nil, "", nil},
+		{
+			"still downloading",
+			[]api.Disk{{ID: "a", Name: hccommon.DownloadingDiskPrefix + "ubuntu.iso " + sha256.String()}},
+			"", nil,
+		},
+		{
+			"strongest checksum first",
+			[]api.Disk{
+				{ID: "a", Name: "ubuntu.iso " + md5.String()},
+				{ID: "b", Name: "ubuntu.iso " + sha256.String()},
+			},
+			"b", &sha256,
+		},
+		{
+			"weaker checksum",
+			[]api.Disk{{ID: "a", Name: "ubuntu.iso MD5=" + testMD5}},
+			"a", &md5,
+		},
+		{
+			"other region",
+			[]api.Disk{{ID: "a", Name: "ubuntu.iso " + sha256.String(), Region: api.Region{ID: "elsewhere"}}},
+			"", nil,
+		},
+	} {
+		disk, sum := cachedBootDisk(tc.disks, config)
+		var got string
+		if disk != nil {
+			got = disk.ID
+		}
+		if got != tc.want || !reflect.DeepEqual(sum, tc.sum) {
+			t.Errorf("%s: cachedBootDisk = %q, %v, want %q, %v", tc.name, got, sum, tc.want, tc.sum)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package vnc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/thehypercloud/packer-hypercloud/api"
+	hccommon "github.com/thehypercloud/packer-hypercloud/builder/hypercloud/common"
+)
+
+// Anything smaller than this probably isn't an ISO
+const minBootDiskSize = 10 * 1024 * 1024
+
+// shellQuote quotes s as a single word for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func isHTTPURL(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// localPath returns the path of an ISO URL that names a local file, either
+// as a file:// URL or a plain path
+func localPath(rawurl string) (string, bool) {
+	if strings.HasPrefix(rawurl, "file://") {
+		return strings.TrimPrefix(rawurl, "file://"), true
+	}
+	u, err := url.Parse(rawurl)
+	// A one letter scheme is a Windows drive
+	if err != nil || u.Scheme == "" || len(u.Scheme) == 1 {
+		return rawurl, true
+	}
+	return "", false
+}
+
+// bootDiskSize checks an ISO URL exists, and returns its size in bytes
+func bootDiskSize(rawurl string) (int64, error) {
+	if path, ok := localPath(rawurl); ok {
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0, fmt.Errorf("Error checking boot disk URL %s: %w", rawurl, err)
+		}
+		if !info.Mode().IsRegular() {
+			return 0, fmt.Errorf("Error checking boot disk URL %s: %s is not a regular file", rawurl, path)
+		}
+		if info.Size() < minBootDiskSize {
+			return 0, fmt.Errorf("Error checking boot disk URL %s: it is less than 10 MB - probably not an ISO", rawurl)
+		}
+		return info.Size(), nil
+	}
+
+	resp, err := http.Head(rawurl)
+	if err != nil {
+		return 0, fmt.Errorf("Error checking boot disk URL %s: %w", rawurl, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return 0, fmt.Errorf("Error checking boot disk URL %s: Status code returned was %d, expected 200", rawurl, resp.StatusCode)
+	}
+	size_header := resp.Header.Get("Content-Length")
+	if size_header == "" {
+		return 0, fmt.Errorf("Error checking boot disk URL %s: No Content-Length header was present", rawurl)
+	}
+	size, err := strconv.ParseInt(size_header, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Error checking boot disk URL %s: Content-Length header was not an integer: %s", rawurl, size_header)
+	}
+	if size < minBootDiskSize {
+		return 0, fmt.Errorf("Error checking boot disk URL %s: it is less than 10 MB - probably not an ISO", rawurl)
+	}
+	return size, nil
+}
+
+// transfer writes the ISO to a new disk, which is named for the build
+// and checksum once complete. Each of the ISO's URLs is tried in turn,
+// until one passes the sanity check and is transferred.
+func (s *stepPrepareBootDisk) transfer(state multistep.StateBag) (*api.Disk, error) {
+	config := state.Get("config").(*Config)
+	client := state.Get("client").(*api.Client)
+	ctx := state.Get("context").(context.Context)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	var downloader *hccommon.HelperInstance
+	var disk *api.Disk
+	var errs []string
+	for _, isoURL := range config.isoURLs {
+		ui.Say(fmt.Sprintf("Sanity checking the boot disk URL exists: %s", isoURL))
+		size, err := bootDiskSize(isoURL)
+		if err != nil {
+			ui.Error(err.Error())
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		ui.Say(fmt.Sprintf("Using boot disk URL %s", isoURL))
+		disk, err = s.claim(state, size)
+		if err == errClaimLost {
+			// Whatever this build launched would only sit idle while it
+			// waits for the other build's transfer
+			s.discard(state)
+			s.terminateDownloader(state)
+			return nil, err
+		}
+		// The downloader is only launched once the boot disk is claimed,
+		// and is reused for each URL tried after that
+		if err == nil && downloader == nil {
+			downloader, err = s.downloader(state)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err == nil {
+			err = downloadBootDisk(state, downloader, disk, isoURL, size)
+		}
+		if err == nil {
+			break
+		}
+		disk = nil
+		ui.Error(err.Error())
+		errs = append(errs, err.Error())
+		s.discard(state)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	if disk == nil {
+		return nil, fmt.Errorf("Error transferring boot disk, no URL succeeded:\n%s", strings.Join(errs, "\n"))
+	}
+
+	// Rename the disk to the builder name, and include the strongest checksum
+	disk, err := api.UpdateDisk(client, disk.ID, map[string]interface{}{
+		"name": config.PackerBuildName + " " + config.checksums[0].String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error renaming boot_disk: %w", err)
+	}
+	// The transfer is complete, so the disk is kept for later builds
+	s.downloading = nil
+
+	// Live detach the boot disk from downloader VM
+	if err := downloader.Detach(ctx, client, disk.ID); err != nil {
+		return nil, fmt.Errorf("Error live detaching boot disk from instance: %w", err)
+	}
+	s.terminateDownloader(state)
+	return disk, nil
+}
+
+// terminateDownloader terminates the downloader VM if it was launched for
+// this build
+func (s *stepPrepareBootDisk) terminateDownloader(state multistep.StateBag) {
+	if s.launched == nil {
+		return
+	}
+	ui := state.Get("ui").(packersdk.Ui)
+	ui.Say("Terminating the downloader VM")
+	s.launched.Destroy(state)
+	s.launched = nil
+}
+
+// claim creates a new disk of at least size bytes for the ISO, which
+// claims the boot disk unless another build got there first, in which case
+// errClaimLost is returned
+func (s *stepPrepareBootDisk) claim(state multistep.StateBag, size int64) (*api.Disk, error) {
+	config := state.Get("config").(*Config)
+	client := state.Get("client").(*api.Client)
+	ctx := state.Get("context").(context.Context)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	// Whole GB, and never smaller than the 10 GB the downloader always used
+	size_gb := uint((size + 1<<30 - 1) >> 30)
+	if size_gb < 10 {
+		size_gb = 10
+	}
+	ui.Say("Creating blank disk to be used as the boot disk")
+	name := hccommon.DownloadingDiskPrefix + config.PackerBuildName + " " + config.checksums[0].String()
+	disk, err := api.CreateBlankDisk(ctx, client, size_gb, name, config.RegionID(), config.DiskPerformanceTierID, config.BuildTags())
+	s.downloading = disk
+	if err != nil {
+		return nil, fmt.Errorf("Error creating new blank disk for boot disk via api: %w", err)
+	}
+
+	disks, err := api.DiskList(client)
+	if err != nil {
+		return nil, fmt.Errorf("Error listing disks: %w", err)
+	}
+	if claims := bootDiskClaims(disks, config); len(claims) > 0 && claims[0].ID != disk.ID {
+		return nil, errClaimLost
+	}
+	return disk, nil
+}
+
+// downloader returns the downloader VM, launching one from the downloader
+// template unless a downloader_vm_id is configured
+func (s *stepPrepareBootDisk) downloader(state multistep.StateBag) (*hccommon.HelperInstance, error) {
+	config := state.Get("config").(*Config)
+	client := state.Get("client").(*api.Client)
+	ctx := state.Get("context").(context.Context)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	ssh_config, err := sshConfig(state)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.DownloaderVMID != "" {
+		ui.Say(fmt.Sprintf("Checking for downloader VM with ID: %s", config.DownloaderVMID))
+		if _, err := api.InstanceInfo(client, config.DownloaderVMID); err != nil {
+			return nil, fmt.Errorf("Error getting info for Download VM: %w", err)
+		}
+		return &hccommon.HelperInstance{ID: config.DownloaderVMID, SSHConfig: ssh_config}, nil
+	}
+
+	s.launched, err = hccommon.LaunchHelperInstance(ctx, client, ui, &hccommon.HelperLaunch{
+		Name:           hccommon.BuildResourcePrefix + config.PackerBuildName + " downloader",
+		Template:       config.downloaderTemplate(),
+		Region:         config.RegionID(),
+		DiskTierID:     config.DiskPerformanceTierID,
+		InstanceTierID: config.InstancePerformanceTierID,
+		NetworkID:      config.NetworkID,
+		Memory:         512,
+		SSHPassword:    config.Comm.SSHPassword,
+		SSHPrivateKey:  config.Comm.SSHPrivateKeyFile,
+		SSHWaitTimeout: config.Comm.SSHTimeout,
+		Tags:           config.BuildTags(),
+	}, ssh_config)
+	if err != nil {
+		return nil, fmt.Errorf("Error launching downloader VM: %w", err)
+	}
+	return s.launched, nil
+}
+
+// serveISO serves the local file at path over HTTP from the machine
+// running packer, on a port between http_port_min and http_port_max, and
+// returns the URL the downloader VM can fetch it from. The server stops
+// when closed.
+func serveISO(config *Config, path string) (string, io.Closer, error) {
+	ip := config.HTTPIP
+	if ip == "" {
+		var err error
+		if ip, err = findFirstIP(); err != nil {
+			return "", nil, fmt.Errorf("http_ip not supplied, failed to guess the local ip to serve %s from: %w", path, err)
+		}
+	}
+
+	l, port := listenInRange(config.HTTPPortMin, config.HTTPPortMax)
+	name := filepath.Base(path)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+name {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, path)
+	})}
+	go server.Serve(l)
+
+	host := net.JoinHostPort(ip, strconv.Itoa(int(port)))
+	return fmt.Sprintf("http://%s/%s", host, url.PathEscape(name)), server, nil
+}
+
+// downloadBootDisk attaches the disk to the downloader VM, and writes the
+// ISO at isoURL to it with wget over SSH. A local ISO is served to the
+// downloader VM from the machine running packer.
+func downloadBootDisk(state multistep.StateBag, downloader *hccommon.HelperInstance, disk *api.Disk, isoURL string, size int64) error {
+	config := state.Get("config").(*Config)
+	client := state.Get("client").(*api.Client)
+	ctx := state.Get("context").(context.Context)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	fetchURL := isoURL
+	if path, ok := localPath(isoURL); ok {
+		served, server, err := serveISO(config, path)
+		if err != nil {
+			return err
+		}
+		defer server.Close()
+		ui.Say(fmt.Sprintf("Serving %s to the downloader VM at %s", path, served))
+		fetchURL = served
+	}
+
+	target_device, err := downloader.Attach(ctx, client, ui, disk.ID)
+	if err != nil {
+		return fmt.Errorf("Error attaching new boot disk to downloader VM: %w", err)
+	}
+
+	comm, err := downloader.Connect(client, true)
+	if err != nil {
+		return fmt.Errorf("Connecting to Downloader VM failed: %w", err)
+	}
+
+	ui.Say("Running SSH command to download file and dd to boot disk")
+	command := fmt.Sprintf("wget %s -qO- > %s", shellQuote(fetchURL), target_device)
+	for _, sum := range config.checksums {
+		command += fmt.Sprintf(" && if [ $(dd if=%s | head -c %d | %s | cut -d ' ' -f1) != \"%s\" ]; then echo '%s does not match'; exit 111; fi",
+			target_device, size, sum.command(), sum.Value, sum.Type)
+	}
+	log.Printf("Downloader command: %s", command)
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	remoteCmd := &packersdk.RemoteCmd{
+		Command: command,
+		Stdout:  stdout,
+		Stderr:  stderr,
+	}
+	if err := comm.Start(ctx, remoteCmd); err != nil {
+		return fmt.Errorf("Error starting download command: %w", err)
+	}
+	if status := remoteCmd.Wait(); status != 0 {
+		return fmt.Errorf("Got exit status %d from downloader SSH command, expected 0. Stdout: %s. Stderr: %s", status, stdout.String(), stderr.String())
+	}
+	return nil
+}
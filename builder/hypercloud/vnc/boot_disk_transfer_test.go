@@ -0,0 +1,98 @@
+package vnc
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalPath(t *testing.T) {
+	for _, tc := range []struct {
+		url   string
+		path  string
+		local bool
+	}{
+		{"/isos/ubuntu.iso", "/isos/ubuntu.iso", true},
+		{"isos/ubuntu.iso", "isos/ubuntu.iso", true},
+		{"file:///isos/ubuntu.iso", "/isos/ubuntu.iso", true},
+		{`C:\isos\ubuntu.iso`, `C:\isos\ubuntu.iso`, true},
+		{"http://example.com/ubuntu.iso", "", false},
+		{"https://example.com/ubuntu.iso", "", false},
+		{"ftp://example.com/ubuntu.iso", "", false},
+	} {
+		path, local := localPath(tc.url)
+		if path != tc.path || local != tc.local {
+			t.Errorf("localPath(%q) = %q, %v, expected %q, %v", tc.url, path, local, tc.path, tc.local)
+		}
+	}
+}
+
+func TestBootDiskSizeLocal(t *testing.T) {
+	dir := t.TempDir()
+	iso := filepath.Join(dir, "ubuntu.iso")
+	if err := os.WriteFile(iso, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(iso, minBootDiskSize+1); err != nil {
+		t.Fatal(err)
+	}
+	small := filepath.Join(dir, "small.iso")
+	if err := os.WriteFile(small, []byte("not an iso"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rawurl := range []string{iso, "file://" + iso} {
+		size, err := bootDiskSize(rawurl)
+		if err != nil {
+			t.Errorf("bootDiskSize(%s): %s", rawurl, err)
+		} else if size != minBootDiskSize+1 {
+			t.Errorf("bootDiskSize(%s) = %d, expected %d", rawurl, size, minBootDiskSize+1)
+		}
+	}
+	for _, rawurl := range []string{small, dir, filepath.Join(dir, "missing.iso")} {
+		if _, err := bootDiskSize(rawurl); err == nil {
+			t.Errorf("bootDiskSize(%s) succeeded, expected an error", rawurl)
+		}
+	}
+}
+
+func TestServeISO(t *testing.T) {
+	iso := filepath.Join(t.TempDir(), "ubuntu 16.04.iso")
+	if err := os.WriteFile(iso, []byte("iso contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{HTTPIP: "127.0.0.1", HTTPPortMin: 18000, HTTPPortMax: 18100}
+
+	served, server, err := serveISO(config, iso)
+	if err != nil {
+		t.Fatalf("serveISO: %s", err)
+	}
+	defer server.Close()
+	if !strings.HasPrefix(served, "http://127.0.0.1:") || !strings.HasSuffix(served, "/ubuntu%2016.04.iso") {
+		t.Errorf("served at %s", served)
+	}
+
+	resp, err := http.Get(served)
+	if err != nil {
+		t.Fatalf("GET %s: %s", served, err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "iso contents" {
+		t.Errorf("GET %s returned %d %q", served, resp.StatusCode, body)
+	}
+
+	// Nothing else on the machine is served
+	other := served[:strings.LastIndex(served, "/")] + "/"
+	resp, err = http.Get(other)
+	if err != nil {
+		t.Fatalf("GET %s: %s", other, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET %s returned %d, expected 404", other, resp.StatusCode)
+	}
+}
@@ -1,102 +1,112 @@
 package vnc
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"strings"
 	"time"
 
-	"github.com/mitchellh/multistep"
-	"github.com/hashicorp/packer/common"
-	"github.com/hashicorp/packer/helper/communicator"
-	"github.com/hashicorp/packer/helper/config"
-	"github.com/hashicorp/packer/packer"
-	"github.com/hashicorp/packer/template/interpolate"
-	"github.com/thehypercloud/apiclient-go"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	"github.com/hashicorp/packer-plugin-sdk/communicator"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
 	"github.com/thehypercloud/packer-hypercloud/api"
+	hccommon "github.com/thehypercloud/packer-hypercloud/builder/hypercloud/common"
 )
 
 type Builder struct {
 	config Config
-	runner multistep.Runner
 }
 
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+
 type Config struct {
-	common.PackerConfig `mapstructure:",squash"`
-	Comm                communicator.Config `mapstructure:",squash"`
-
-	InstallerDiskID          string `mapstructure:"installer_disk_id"`
-	DiskPerformanceTierID    string `mapstructure:"disk_performance_tier_id"`
-	InstancePerforanceTierID string `mapstructure:"instance_performance_tier_id"`
-	DiskSize                 uint   `mapstructure:"disk_size"`
-	BootDiskMD5              string `mapstructure:"boot_disk_md5"`
-	BootDiskURL              string `mapstructure:"boot_disk_url"`
-	DownloaderVMID           string `mapstructure:"downloader_vm_id"`
-	NetworkID                string `mapstructure:"network_id"`
-	Memory                   uint   `mapstructure:"memory"`
-	HYPERCLOUD_ID            string `mapstructure:"hypercloud_id"`
-	HYPERCLOUD_SECRET        string `mapstructure:"hypercloud_secret"`
-	HYPERCLOUD_URL           string `mapstructure:"hypercloud_url"`
-	HYPERCLOUD_ACCESS_TOKEN  string `mapstructure:"hypercloud_access_token"`
-
-	BootCommand     []string `mapstructure:"boot_command"`
-	HTTPDir         string   `mapstructure:"http_directory"`
-	HTTPIP          string   `mapstructure:"http_ip"`
-	HTTPPortMin     uint     `mapstructure:"http_port_min"`
-	HTTPPortMax     uint     `mapstructure:"http_port_max"`
-	ShutdownCommand string   `mapstructure:"shutdown_command"`
-	VNCPortMin      uint     `mapstructure:"vnc_port_min"`
-	VNCPortMax      uint     `mapstructure:"vnc_port_max"`
-
-	RawBootWait        string        `mapstructure:"boot_wait"`
-	RawShutdownTimeout string        `mapstructure:"shutdown_timeout"`
-	SSHWaitTimeout     time.Duration `mapstructure:"ssh_wait_timeout"`
-
-	HYPERCLOUD_IP      string
-	HYPERCLOUD_NETMASK string
-	HYPERCLOUD_CIDR    string
-	HYPERCLOUD_GATEWAY string
-
-	regionId       string
+	common.PackerConfig         `mapstructure:",squash"`
+	Comm                        communicator.Config `mapstructure:",squash"`
+	hccommon.TagConfig          `mapstructure:",squash"`
+	hccommon.ArtifactNameConfig `mapstructure:",squash"`
+	hccommon.PublishConfig      `mapstructure:",squash"`
+	hccommon.LocationConfig     `mapstructure:",squash"`
+	hccommon.PreflightConfig    `mapstructure:",squash"`
+	hccommon.AccessConfig       `mapstructure:",squash"`
+	hccommon.RunConfig          `mapstructure:",squash"`
+
+	InstallerDiskID        string   `mapstructure:"installer_disk_id"`
+	BootDiskMD5            string   `mapstructure:"boot_disk_md5"`
+	ISOChecksum            string   `mapstructure:"iso_checksum"`
+	BootDiskURL            string   `mapstructure:"boot_disk_url"`
+	ISOURLs                []string `mapstructure:"iso_urls"`
+	DownloaderVMID         string   `mapstructure:"downloader_vm_id"`
+	DownloaderTemplateID   string   `mapstructure:"downloader_template_id"`
+	DownloaderTemplateName string   `mapstructure:"downloader_template_name"`
+	DownloaderTemplateSlug string   `mapstructure:"downloader_template_slug"`
+
+	BootCommand []string `mapstructure:"boot_command"`
+	HTTPDir     string   `mapstructure:"http_directory"`
+	HTTPIP      string   `mapstructure:"http_ip"`
+	HTTPPortMin uint     `mapstructure:"http_port_min"`
+	HTTPPortMax uint     `mapstructure:"http_port_max"`
+	VNCPortMin  uint     `mapstructure:"vnc_port_min"`
+	VNCPortMax  uint     `mapstructure:"vnc_port_max"`
+
+	RawBootDiskWaitTimeout string `mapstructure:"boot_disk_wait_timeout"`
+
+	checksums      []checksum // strongest first
+	isoURLs        []string   // boot_disk_url or iso_urls, in the order to try them
 	virtualization string
 
-	bootWait        time.Duration ``
-	shutdownTimeout time.Duration ``
-	ctx             interpolate.Context
+	bootDiskWaitTimeout time.Duration ``
+	ctx                 interpolate.Context
+}
+
+func (c *Config) downloaderTemplate() hccommon.TemplateSource {
+	return hccommon.TemplateSource{ID: c.DownloaderTemplateID, Slug: c.DownloaderTemplateSlug, Name: c.DownloaderTemplateName}
+}
+
+// ConfigSpec describes the builder's options to HCL2 templates. JSON
+// templates are still decoded by Prepare alone.
+func (self *Builder) ConfigSpec() hcldec.ObjectSpec {
+	return self.config.FlatMapstructure().HCL2Spec()
 }
 
-func (self *Builder) Prepare(raws ...interface{}) (params []string, retErr error) {
+func (self *Builder) Prepare(raws ...interface{}) ([]string, []string, error) {
 	err := config.Decode(&self.config, &config.DecodeOpts{
-		Interpolate: true,
+		PluginType:         "hypercloud-vnc",
+		Interpolate:        true,
+		InterpolateContext: &self.config.ctx,
 		InterpolateFilter: &interpolate.RenderFilter{
 			Exclude: []string{
 				"boot_command",
+				"disk_name",
+				"disk_description",
 			},
 		},
 	}, raws...)
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	var errs *packer.MultiError
+	var errs *packersdk.MultiError
 
 	// Set defaults
 
 	self.config.virtualization = "hvm" // We could do pv, but need to add serial support to this plugin
 
-	if self.config.DiskSize == 0 {
-		self.config.DiskSize = 10
-	}
-
-	if self.config.Memory == 0 {
-		self.config.Memory = 512
-	}
-
 	if self.config.RawBootWait == "" {
 		self.config.RawBootWait = "10s"
 	}
-	self.config.bootWait, err = time.ParseDuration(self.config.RawBootWait)
+
+	// Without a shutdown_command there is nothing to power off the
+	// installed OS, so it is stopped through the API
+	if self.config.ShutdownCommand == "" {
+		self.config.ShutdownFromAPI = true
+	}
 
 	if self.config.VNCPortMin == 0 {
 		self.config.VNCPortMin = 5900
@@ -114,156 +124,190 @@ func (self *Builder) Prepare(raws ...interface{}) (params []string, retErr error
 		self.config.HTTPPortMax = 9000
 	}
 
-	if self.config.SSHWaitTimeout != 0 {
-		self.config.Comm.SSHTimeout = self.config.SSHWaitTimeout
-	}
-
-	if self.config.RawShutdownTimeout == "" {
-		self.config.RawShutdownTimeout = "5m"
+	if self.config.RawBootDiskWaitTimeout == "" {
+		self.config.RawBootDiskWaitTimeout = "1h"
 	}
 
 	if self.config.Comm.SSHUsername == "" {
-		errs = packer.MultiErrorAppend(
+		errs = packersdk.MultiErrorAppend(
 			errs, errors.New("An ssh_username must be specified."))
 	}
 
-	if self.config.HYPERCLOUD_URL == "" {
-		errs = packer.MultiErrorAppend(errs, fmt.Errorf("hypercloud_url is required"))
+	if es := self.config.AccessConfig.Prepare(); len(es) > 0 {
+		errs = packersdk.MultiErrorAppend(errs, es...)
 	}
 
-	if self.config.HYPERCLOUD_ID != "" || self.config.HYPERCLOUD_SECRET != "" {
-		if self.config.HYPERCLOUD_ID == "" {
-			errs = packer.MultiErrorAppend(errs, fmt.Errorf("hypercloud_id is required when hypercloud_secret is provided"))
-		} else if self.config.HYPERCLOUD_SECRET == "" {
-			errs = packer.MultiErrorAppend(errs, fmt.Errorf("hypercloud_secret is required when hypercloud_id is provided"))
+	if self.config.BootDiskMD5 == "" && self.config.ISOChecksum == "" {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("iso_checksum or boot_disk_md5 is required"))
+	}
+	if self.config.BootDiskMD5 != "" {
+		if _, err := parseChecksum("md5:" + self.config.BootDiskMD5); err != nil {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("boot_disk_md5: %s", err))
 		}
-	} else if self.config.HYPERCLOUD_ACCESS_TOKEN == "" {
-		errs = packer.MultiErrorAppend(errs, fmt.Errorf("either hypercloud_access_token or both hypercloud_id and hypercloud_secret are required"))
 	}
-
-	if self.config.DiskPerformanceTierID == "" {
-		errs = packer.MultiErrorAppend(errs, fmt.Errorf("disk_performance_tier_id is required"))
+	if self.config.ISOChecksum != "" && !strings.HasPrefix(self.config.ISOChecksum, "file:") {
+		if _, err := parseChecksum(self.config.ISOChecksum); err != nil {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("iso_checksum: %s", err))
+		}
 	}
-	if self.config.InstancePerforanceTierID == "" {
-		errs = packer.MultiErrorAppend(errs, fmt.Errorf("instance_performance_tier_id is required"))
+	if self.config.BootDiskURL != "" && len(self.config.ISOURLs) > 0 {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("only one of boot_disk_url or iso_urls may be given"))
+	} else if self.config.BootDiskURL != "" {
+		self.config.isoURLs = []string{self.config.BootDiskURL}
+	} else if len(self.config.ISOURLs) > 0 {
+		self.config.isoURLs = self.config.ISOURLs
+	} else {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("boot_disk_url or iso_urls is required"))
 	}
-	if self.config.BootDiskMD5 == "" {
-		errs = packer.MultiErrorAppend(errs, fmt.Errorf("boot_disk_md5 is required"))
+	given := self.config.downloaderTemplate().Given()
+	if self.config.DownloaderVMID != "" {
+		given += 1
 	}
-	if self.config.BootDiskURL == "" {
-		errs = packer.MultiErrorAppend(errs, fmt.Errorf("boot_disk_url is required"))
+	if given != 1 {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("must provide 1 of downloader_vm_id, downloader_template_id, downloader_template_name or downloader_template_slug"))
 	}
-
-	if self.config.NetworkID == "" {
-		errs = packer.MultiErrorAppend(errs, fmt.Errorf("network_id is required"))
+	if self.config.DownloaderVMID == "" && self.config.Comm.SSHPassword == "" && self.config.Comm.SSHPrivateKeyFile == "" {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("ssh_private_key_file or ssh_password is required to connect to a downloader launched from a template"))
+	}
+	for _, isoURL := range self.config.isoURLs {
+		if _, local := localPath(isoURL); !local && !isHTTPURL(isoURL) {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("%s must be an http or https URL, a file:// URL or a local path", isoURL))
+		}
 	}
 
 	if self.config.HTTPPortMin > self.config.HTTPPortMax {
-		errs = packer.MultiErrorAppend(
+		errs = packersdk.MultiErrorAppend(
 			errs, errors.New("http_port_min must be less than http_port_max"))
 	}
 
 	if es := self.config.Comm.Prepare(&self.config.ctx); len(es) > 0 {
-		errs = packer.MultiErrorAppend(errs, es...)
+		errs = packersdk.MultiErrorAppend(errs, es...)
+	}
+	if es := self.config.RunConfig.Prepare(); len(es) > 0 {
+		errs = packersdk.MultiErrorAppend(errs, es...)
+	}
+	if es := self.config.LocationConfig.Prepare(); len(es) > 0 {
+		errs = packersdk.MultiErrorAppend(errs, es...)
+	}
+	if es := self.config.ArtifactNameConfig.Prepare(&self.config.ctx); len(es) > 0 {
+		errs = packersdk.MultiErrorAppend(errs, es...)
+	}
+	if es := self.config.PublishConfig.Prepare(); len(es) > 0 {
+		errs = packersdk.MultiErrorAppend(errs, es...)
+	}
+	source := ""
+	if len(self.config.isoURLs) > 0 {
+		source = self.config.isoURLs[0]
+	}
+	if es := self.config.TagConfig.Prepare(self.config.PackerBuildName, source); len(es) > 0 {
+		errs = packersdk.MultiErrorAppend(errs, es...)
 	}
 
-	self.config.shutdownTimeout, err = time.ParseDuration(self.config.RawShutdownTimeout)
+	self.config.bootDiskWaitTimeout, err = time.ParseDuration(self.config.RawBootDiskWaitTimeout)
 	if err != nil {
-		errs = packer.MultiErrorAppend(
-			errs, fmt.Errorf("Failed parsing shutdown_timeout: %s", err))
+		errs = packersdk.MultiErrorAppend(
+			errs, fmt.Errorf("Failed parsing boot_disk_wait_timeout: %s", err))
 	}
 
 	if errs != nil && len(errs.Errors) > 0 {
-		return nil, errs
+		return nil, nil, errs
 	}
-	return nil, nil
-}
 
-func (self *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packer.Artifact, error) {
-	var client hypercloud.ApiClient
-	if self.config.HYPERCLOUD_ACCESS_TOKEN == "" {
-		client = hypercloud.NewApplicationClient(self.config.HYPERCLOUD_URL, self.config.HYPERCLOUD_ID, self.config.HYPERCLOUD_SECRET)
-	} else {
-		client = hypercloud.NewAccessTokenClient(self.config.HYPERCLOUD_URL, self.config.HYPERCLOUD_ACCESS_TOKEN)
+	// Only check the resources once the config is otherwise valid
+	if self.config.Preflight {
+		preflight := &hccommon.Preflight{Client: self.config.Client(nil)}
+		if preflight.Connect() {
+			region := preflight.Location(&self.config.LocationConfig)
+			if self.config.DownloaderVMID != "" {
+				preflight.Instance("downloader_vm_id", self.config.DownloaderVMID)
+			} else if region != "" {
+				preflight.Template("downloader template", self.config.downloaderTemplate(), region, 0)
+			}
+		}
+		if len(preflight.Errors) > 0 {
+			return nil, nil, packersdk.MultiErrorAppend(nil, preflight.Errors...)
+		}
 	}
+	return nil, nil, nil
+}
+
+func (self *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook) (packersdk.Artifact, error) {
+	// ctx is cancelled by Packer on interrupt, stopping any in-flight polling
+	client := self.config.Client(ui)
+	client.Context = ctx
 
 	//Share state between the other steps using a statebag
 	state := new(multistep.BasicStateBag)
-	state.Put("cache", cache)
-	state.Put("client", &client)
+	state.Put("client", client)
+	state.Put("context", ctx)
 	state.Put("config", &self.config)
 	state.Put("hook", hook)
 	state.Put("ui", ui)
 
-	steps := []multistep.Step{
+	// Run!
+	runner := commonsteps.NewRunner(self.steps(), self.config.PackerConfig, ui)
+	runner.Run(ctx, state)
+	hccommon.ReportLeaks(ui, state, self.config.PackerOnError)
+
+	if err := hccommon.RunError(state); err != nil {
+		return nil, err
+	}
+
+	artifact := &hccommon.Artifact{
+		DiskBuilderID: hccommon.VNCBuilderID,
+		Disk:          state.Get("disk").(*api.Disk),
+		Client:        client,
+	}
+	if template, ok := state.GetOk("template_published"); ok {
+		artifact.Template = template.(*api.Template)
+	}
+	return artifact, nil
+}
+
+// steps returns the steps of a build, in the order they are run
+func (self *Builder) steps() []multistep.Step {
+	return []multistep.Step{
 		new(stepPrepareBootDisk),
 		new(stepHTTPServer),
 		new(stepCreateDisk),
-		new(stepAllocateIP),
-		new(stepBuildInstance),
-		new(stepBootInstance),
+		&hccommon.StepAllocateIP{
+			Location:  &self.config.LocationConfig,
+			BuildName: self.config.PackerBuildName,
+			Tags:      self.config.BuildTags(),
+		},
+		&hccommon.StepBuildInstance{
+			Config:     &self.config.RunConfig,
+			Location:   &self.config.LocationConfig,
+			BuildName:  self.config.PackerBuildName,
+			Tags:       self.config.BuildTags(),
+			DiskKeys:   []string{"disk", "boot_disk"},
+			BootDevice: "cdrom",
+		},
+		&hccommon.StepBootInstance{Config: &self.config.RunConfig},
 		new(stepConfigureVNC),
 		new(stepTypeBootCommand),
 		new(stepDisableCDBoot),
 		&communicator.StepConnect{
 			Config:    &self.config.Comm,
-			Host:      commHost,
+			Host:      hccommon.CommHost,
 			SSHConfig: sshConfig,
 			SSHPort:   commPort,
 		},
-		new(common.StepProvision),
-		new(stepShutdown),
-		new(stepCleanup),
-	}
-
-	// Run!
-	if self.config.PackerDebug {
-		self.runner = &multistep.DebugRunner{
-			Steps:   steps,
-			PauseFn: common.MultistepDebugFn(ui),
-		}
-	} else {
-		self.runner = &multistep.BasicRunner{Steps: steps}
-	}
-
-	self.runner.Run(state)
-
-	// If there was an error, return that
-	if rawErr, ok := state.GetOk("error"); ok {
-		return nil, rawErr.(error)
-	}
-
-	// If we were interrupted or cancelled, then just exit.
-	if _, ok := state.GetOk(multistep.StateCancelled); ok {
-		return nil, errors.New("Build was cancelled.")
-	}
-
-	if _, ok := state.GetOk(multistep.StateHalted); ok {
-		return nil, errors.New("Build was halted.")
-	}
-
-	disk := state.Get("disk").(map[string]interface{})
-	diskId := disk["id"].(string)
-
-	// Rename the disk to signify success
-	timeStr := time.Now().Format("2006-01-02 15:04:05")
-	newDiskName := fmt.Sprintf("Packer completed: %s %s", self.config.PackerBuildName, timeStr)
-	disk, _ = api.UpdateDisk(&client, diskId, map[string]interface{}{
-		"name": newDiskName,
-	})
-
-	artifact := &Artifact{
-		diskId: diskId,
-		state:  disk,
-		client: &client,
-	}
-	return artifact, nil
-}
-
-func (self *Builder) Cancel() {
-	if self.runner != nil {
-		log.Println("Cancelling the step runner...")
-		self.runner.Cancel()
+		new(commonsteps.StepProvision),
+		&hccommon.StepShutdown{Config: &self.config.RunConfig},
+		new(hccommon.StepCleanup),
+		&hccommon.StepNameDisk{
+			Config:    &self.config.ArtifactNameConfig,
+			Ctx:       &self.config.ctx,
+			BuildName: self.config.PackerBuildName,
+			Tags:      self.config.ArtifactTags(),
+			SourceName: func(state multistep.StateBag) string {
+				return state.Get("boot_disk_source").(*api.Disk).Name
+			},
+		},
+		&hccommon.StepPublishTemplate{
+			Config: &self.config.PublishConfig,
+			Tags:   self.config.ArtifactTags(),
+		},
 	}
-	fmt.Println("Cancelling the builder")
 }
@@ -0,0 +1,197 @@
+package vnc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/thehypercloud/packer-hypercloud/api"
+	"github.com/thehypercloud/packer-hypercloud/api/hypercloudtest"
+	hccommon "github.com/thehypercloud/packer-hypercloud/builder/hypercloud/common"
+)
+
+// testConfig is a valid config for a build against srv which finds its boot
+// disk in the cache, and doesn't need to connect to the instance
+func testConfig(srv *hypercloudtest.Server, f hypercloudtest.Fixture) map[string]interface{} {
+	return map[string]interface{}{
+		"packer_build_name":            "web",
+		"communicator":                 "none",
+		"ssh_username":                 "root",
+		"ssh_password":                 "secret",
+		"boot_wait":                    "0s",
+		"boot_command":                 []string{"<enter>"},
+		"boot_disk_url":                "http://mirror.example.net/releases/ubuntu.iso",
+		"iso_checksum":                 "sha256:" + testSHA256,
+		"downloader_template_slug":     "ubuntu-16.04",
+		"disk_performance_tier_id":     f.DiskTierID,
+		"instance_performance_tier_id": f.InstanceTierID,
+		"network_id":                   f.NetworkID,
+		"disk_name":                    "{{build_name}} from {{.SourceTemplate}}",
+		"hypercloud_url":               srv.URL,
+		"hypercloud_access_token":      hypercloudtest.Token,
+	}
+}
+
+// stepCheckVNC stands in for stepTypeBootCommand, which needs a console
+// the fake can't provide, and checks what it would have connected to
+type stepCheckVNC struct {
+	t *testing.T
+}
+
+func (s *stepCheckVNC) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	session := state.Get("vnc_session").(api.ConsoleSession)
+	if session.Token == "" || session.Url == "" {
+		s.t.Errorf("console session %+v is not ready", session)
+	}
+	if _, ok := state.GetOk("vnc_proxy_port"); !ok {
+		s.t.Errorf("no vnc proxy port chosen")
+	}
+	instance := state.Get("instance").(*api.Instance)
+	if instance.BootDevice != "cdrom" {
+		s.t.Errorf("instance boots from %q, want the cdrom", instance.BootDevice)
+	}
+	return multistep.ActionContinue
+}
+
+func (s *stepCheckVNC) Cleanup(multistep.StateBag) {}
+
+// run runs the builder's steps as Run does, with the boot command step
+// replaced by stepCheckVNC
+func run(t *testing.T, b *Builder, hook packersdk.Hook) (multistep.StateBag, error) {
+	ui := packersdk.TestUi(t)
+	client := b.config.Client(ui)
+	state := new(multistep.BasicStateBag)
+	state.Put("client", client)
+	state.Put("context", context.Background())
+	state.Put("config", &b.config)
+	state.Put("hook", hook)
+	state.Put("ui", ui)
+
+	steps := b.steps()
+	for i, step := range steps {
+		if _, ok := step.(*stepTypeBootCommand); ok {
+			steps[i] = &stepCheckVNC{t: t}
+		}
+	}
+	commonsteps.NewRunner(steps, b.config.PackerConfig, ui).Run(context.Background(), state)
+	return state, hccommon.RunError(state)
+}
+
+func TestBuilderPrepareErrors(t *testing.T) {
+	srv := hypercloudtest.NewServer()
+	defer srv.Close()
+	f := srv.Seed()
+
+	for _, tc := range []struct {
+		name   string
+		change map[string]interface{}
+	}{
+		{"no checksum", map[string]interface{}{"iso_checksum": ""}},
+		{"bad checksum", map[string]interface{}{"iso_checksum": "sha256:abc"}},
+		{"no url", map[string]interface{}{"boot_disk_url": ""}},
+		{"two urls", map[string]interface{}{"iso_urls": []string{"http://mirror.example.net/ubuntu.iso"}}},
+		{"ftp url", map[string]interface{}{"boot_disk_url": "ftp://mirror.example.net/ubuntu.iso"}},
+		{"two downloaders", map[string]interface{}{"downloader_vm_id": f.DownloaderID}},
+		{"no downloader credentials", map[string]interface{}{"ssh_password": ""}},
+		{"no ssh_username", map[string]interface{}{"ssh_username": ""}},
+		{"missing downloader template", map[string]interface{}{"downloader_template_slug": "missing", "preflight": true}},
+	} {
+		config := testConfig(srv, f)
+		for k, v := range tc.change {
+			config[k] = v
+		}
+		var b Builder
+		if _, _, err := b.Prepare(config); err == nil {
+			t.Errorf("%s: Prepare succeeded, want an error", tc.name)
+		}
+	}
+}
+
+func TestBuilderRun(t *testing.T) {
+	srv := hypercloudtest.NewServer()
+	defer srv.Close()
+	f := srv.Seed()
+	srv.Polls = 2
+	cached := srv.AddDisk(f.RegionID, "ubuntu.iso sha256="+testSHA256, 1)
+
+	config := testConfig(srv, f)
+	config["publish_template_name"] = "Web"
+	config["publish_template_slug"] = "web"
+	config["preflight"] = true
+	var b Builder
+	if _, _, err := b.Prepare(config); err != nil {
+		t.Fatalf("Prepare: %s", err)
+	}
+	hook := &packersdk.MockHook{}
+	state, err := run(t, &b, hook)
+	if err != nil {
+		t.Fatalf("Run: %s\nrequests:\n%s", err, strings.Join(srv.Requests(), "\n"))
+	}
+	if !hook.RunCalled {
+		t.Errorf("provision hook not run")
+	}
+
+	// The finished disk is named after the boot disk it was installed from,
+	// tagged as the artifact and published
+	disk, ok := srv.Disk(state.Get("disk").(*api.Disk).ID)
+	if !ok {
+		t.Fatal("artifact disk does not exist")
+	}
+	if want := "web from ubuntu.iso sha256=" + testSHA256; disk.Name != want {
+		t.Errorf("disk is named %q, want %q", disk.Name, want)
+	}
+	if disk.Tags[hccommon.TagArtifact] != "true" {
+		t.Errorf("disk tags are %v", disk.Tags)
+	}
+	template, ok := state.GetOk("template_published")
+	if !ok || template.(*api.Template).Slug != "web" {
+		t.Errorf("published template is %+v", template)
+	}
+
+	// The cached boot disk is kept for later builds, but the build's copy of
+	// it and everything else the build created are gone
+	if ids := srv.DiskIDs(); len(ids) != 3 {
+		t.Errorf("disks %v exist, want only the downloader's, the cached boot disk and the artifact", ids)
+	}
+	if _, ok := srv.Disk(cached); !ok {
+		t.Errorf("cached boot disk was deleted")
+	}
+	if ips := srv.AllocatedIPs(); len(ips) != 1 {
+		t.Errorf("ip addresses %v are allocated, want only the downloader's", ips)
+	}
+	if downloader, _ := srv.Instance(f.DownloaderID); downloader.State != "stopped" {
+		t.Errorf("downloader is %s, want it left stopped", downloader.State)
+	}
+}
+
+func TestBuilderRunRollsBack(t *testing.T) {
+	srv := hypercloudtest.NewServer()
+	defer srv.Close()
+	f := srv.Seed()
+	cached := srv.AddDisk(f.RegionID, "ubuntu.iso sha256="+testSHA256, 1)
+
+	var b Builder
+	if _, _, err := b.Prepare(testConfig(srv, f)); err != nil {
+		t.Fatalf("Prepare: %s", err)
+	}
+	hook := &packersdk.MockHook{RunFunc: func(context.Context) error {
+		return errors.New("provisioner failed")
+	}}
+	if _, err := run(t, &b, hook); err == nil {
+		t.Fatal("Run succeeded despite the provisioner failing")
+	}
+
+	if ids := srv.DiskIDs(); len(ids) != 2 {
+		t.Errorf("disks %v exist, want only the downloader's and the cached boot disk", ids)
+	}
+	if _, ok := srv.Disk(cached); !ok {
+		t.Errorf("cached boot disk was deleted")
+	}
+	if ips := srv.AllocatedIPs(); len(ips) != 1 {
+		t.Errorf("ip addresses %v are allocated, want only the downloader's", ips)
+	}
+}
@@ -0,0 +1,164 @@
+package vnc
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// The supported checksum types, weakest first
+var checksumTypes = []string{"md5", "sha1", "sha256", "sha512"}
+
+// The length in hex of each type of checksum
+var checksumLengths = map[int]string{
+	32:  "md5",
+	40:  "sha1",
+	64:  "sha256",
+	128: "sha512",
+}
+
+// checksum is an expected hash of the boot disk contents
+type checksum struct {
+	Type  string
+	Value string // lower case hex
+}
+
+// String is how the checksum appears in the name of a cached boot disk,
+// e.g. "sha256=..."
+func (c checksum) String() string {
+	return c.Type + "=" + c.Value
+}
+
+func (c checksum) strength() int {
+	for i, t := range checksumTypes {
+		if t == c.Type {
+			return i
+		}
+	}
+	return -1
+}
+
+// command is the coreutils command that prints this type of checksum
+func (c checksum) command() string {
+	return c.Type + "sum"
+}
+
+// byStrength sorts checksums strongest first
+type byStrength []checksum
+
+func (s byStrength) Len() int           { return len(s) }
+func (s byStrength) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byStrength) Less(i, j int) bool { return s[i].strength() > s[j].strength() }
+
+// parseChecksum parses a checksum given as "type:hex", or as bare hex whose
+// type is known from its length
+func parseChecksum(raw string) (checksum, error) {
+	value := strings.ToLower(strings.TrimSpace(raw))
+	var kind string
+	if i := strings.Index(value, ":"); i >= 0 {
+		kind, value = value[:i], value[i+1:]
+	} else {
+		kind = checksumLengths[len(value)]
+		if kind == "" {
+			return checksum{}, fmt.Errorf("can't tell the type of a checksum %d characters long", len(value))
+		}
+	}
+	c := checksum{Type: kind, Value: value}
+	if c.strength() < 0 {
+		return checksum{}, fmt.Errorf("unsupported checksum type %q, must be one of %s", kind, strings.Join(checksumTypes, ", "))
+	}
+	if _, err := hex.DecodeString(value); err != nil || checksumLengths[len(value)] != kind {
+		return checksum{}, fmt.Errorf("%q is not a valid %s checksum", value, kind)
+	}
+	return c, nil
+}
+
+// checksumFromFile finds the checksum of the file at isoURL in a checksum
+// file, such as a SHA256SUMS, in either the coreutils or BSD format. Mirrors
+// are expected to share a file name, so any of the ISO's URLs will do.
+func checksumFromFile(fileURL string, isoURL string) (checksum, error) {
+	var body io.ReadCloser
+	if isHTTPURL(fileURL) {
+		resp, err := http.Get(fileURL)
+		if err != nil {
+			return checksum{}, fmt.Errorf("Error getting checksum file: %w", err)
+		}
+		if resp.StatusCode != 200 {
+			resp.Body.Close()
+			return checksum{}, fmt.Errorf("Error getting checksum file %s: Status code returned was %d, expected 200", fileURL, resp.StatusCode)
+		}
+		body = resp.Body
+	} else {
+		f, err := os.Open(strings.TrimPrefix(fileURL, "file://"))
+		if err != nil {
+			return checksum{}, fmt.Errorf("Error opening checksum file: %w", err)
+		}
+		body = f
+	}
+	defer body.Close()
+
+	name := isoURL
+	if u, err := url.Parse(isoURL); err == nil && u.Path != "" {
+		name = u.Path
+	}
+	name = path.Base(name)
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		var value, file string
+		if i := strings.Index(line, ") = "); strings.Contains(line, " (") && i >= 0 {
+			// BSD: SHA256 (name.iso) = hex
+			file = line[strings.Index(line, " (")+2 : i]
+			value = line[i+4:]
+		} else if fields := strings.Fields(line); len(fields) == 2 {
+			// coreutils: hex  name.iso, or hex *name.iso in binary mode
+			value = fields[0]
+			file = strings.TrimPrefix(fields[1], "*")
+		} else {
+			continue
+		}
+		if path.Base(strings.TrimPrefix(file, "./")) == name {
+			return parseChecksum(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return checksum{}, fmt.Errorf("Error reading checksum file: %w", err)
+	}
+	return checksum{}, fmt.Errorf("No checksum for %s found in %s", name, fileURL)
+}
+
+// bootChecksums returns the checksums the boot disk is verified against,
+// strongest first, fetching a checksum file if one is given
+func (c *Config) bootChecksums() ([]checksum, error) {
+	var checksums []checksum
+	if c.BootDiskMD5 != "" {
+		sum, err := parseChecksum("md5:" + c.BootDiskMD5)
+		if err != nil {
+			return nil, fmt.Errorf("boot_disk_md5: %w", err)
+		}
+		checksums = append(checksums, sum)
+	}
+	if c.ISOChecksum != "" {
+		var sum checksum
+		var err error
+		if strings.HasPrefix(c.ISOChecksum, "file:") {
+			sum, err = checksumFromFile(strings.TrimPrefix(c.ISOChecksum, "file:"), c.isoURLs[0])
+		} else {
+			sum, err = parseChecksum(c.ISOChecksum)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("iso_checksum: %w", err)
+		}
+		checksums = append(checksums, sum)
+	}
+	sort.Stable(byStrength(checksums))
+	return checksums, nil
+}
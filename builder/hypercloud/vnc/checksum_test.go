@@ -0,0 +1,98 @@
+package vnc
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testMD5    = "d41d8cd98f00b204e9800998ecf8427e"
+	testSHA1   = "da39a3ee5e6b4b0d3255bfef95601890afd80709"
+	testSHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+func TestParseChecksum(t *testing.T) {
+	sha512 := strings.Repeat("ab", 64)
+	for _, tc := range []struct {
+		raw  string
+		want checksum
+		err  bool
+	}{
+		{raw: testMD5, want: checksum{"md5", testMD5}},
+		{raw: testSHA1, want: checksum{"sha1", testSHA1}},
+		{raw: testSHA256, want: checksum{"sha256", testSHA256}},
+		{raw: sha512, want: checksum{"sha512", sha512}},
+		{raw: "sha256:" + testSHA256, want: checksum{"sha256", testSHA256}},
+		{raw: "  SHA256:" + strings.ToUpper(testSHA256) + "\n", want: checksum{"sha256", testSHA256}},
+		{raw: "md5:" + testMD5, want: checksum{"md5", testMD5}},
+		{raw: "", err: true},
+		{raw: "abc123", err: true},
+		{raw: "crc32:" + testMD5, err: true},
+		{raw: "sha256:" + testMD5, err: true},
+		{raw: "md5:" + strings.Repeat("zz", 16), err: true},
+		{raw: strings.Repeat("zz", 32), err: true},
+	} {
+		got, err := parseChecksum(tc.raw)
+		if tc.err {
+			if err == nil {
+				t.Errorf("parseChecksum(%q) = %v, want an error", tc.raw, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseChecksum(%q): %s", tc.raw, err)
+		} else if got != tc.want {
+			t.Errorf("parseChecksum(%q) = %v, want %v", tc.raw, got, tc.want)
+		}
+	}
+}
+
+func TestChecksumFromFile(t *testing.T) {
+	coreutils := fmt.Sprintf("%s  other.iso\n%s  ubuntu.iso\n", testMD5, testSHA256)
+	binary := fmt.Sprintf("%s *./ubuntu.iso\n", testSHA256)
+	bsd := fmt.Sprintf("# comment\nSHA1 (other.iso) = %s\nSHA256 (ubuntu.iso) = %s\n", testSHA1, testSHA256)
+
+	dir := t.TempDir()
+	files := map[string]string{"coreutils": coreutils, "binary": binary, "bsd": bsd}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer srv.Close()
+
+	want := checksum{"sha256", testSHA256}
+	for _, tc := range []struct {
+		file string
+		iso  string
+		err  bool
+	}{
+		{file: filepath.Join(dir, "coreutils"), iso: "http://mirror.example.net/releases/ubuntu.iso"},
+		{file: "file://" + filepath.Join(dir, "binary"), iso: "http://mirror.example.net/ubuntu.iso?mirror=1"},
+		{file: filepath.Join(dir, "bsd"), iso: "https://mirror.example.net/ubuntu.iso"},
+		{file: srv.URL + "/coreutils", iso: "http://mirror.example.net/ubuntu.iso"},
+		{file: srv.URL + "/bsd", iso: "ubuntu.iso"},
+		{file: filepath.Join(dir, "coreutils"), iso: "http://mirror.example.net/missing.iso", err: true},
+		{file: filepath.Join(dir, "missing"), iso: "http://mirror.example.net/ubuntu.iso", err: true},
+		{file: srv.URL + "/missing", iso: "http://mirror.example.net/ubuntu.iso", err: true},
+	} {
+		got, err := checksumFromFile(tc.file, tc.iso)
+		if tc.err {
+			if err == nil {
+				t.Errorf("checksumFromFile(%q, %q) = %v, want an error", tc.file, tc.iso, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("checksumFromFile(%q, %q): %s", tc.file, tc.iso, err)
+		} else if got != want {
+			t.Errorf("checksumFromFile(%q, %q) = %v, want %v", tc.file, tc.iso, got, want)
+		}
+	}
+}
@@ -1,41 +1,16 @@
 package vnc
 
 import (
-	"github.com/mitchellh/multistep"
-	commonssh "github.com/hashicorp/packer/common/ssh"
-	"github.com/hashicorp/packer/communicator/ssh"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	hccommon "github.com/thehypercloud/packer-hypercloud/builder/hypercloud/common"
 	gossh "golang.org/x/crypto/ssh"
 )
 
-func commHost(state multistep.StateBag) (string, error) {
-	return state.Get("ssh_address").(string), nil
-}
-
 func commPort(state multistep.StateBag) (int, error) {
 	return 22, nil
 }
 
 func sshConfig(state multistep.StateBag) (*gossh.ClientConfig, error) {
 	config := state.Get("config").(*Config)
-
-	auth := []gossh.AuthMethod{
-		gossh.Password(config.Comm.SSHPassword),
-		gossh.KeyboardInteractive(
-			ssh.PasswordKeyboardInteractive(config.Comm.SSHPassword)),
-	}
-
-	if config.Comm.SSHPrivateKey != "" {
-		signer, err := commonssh.FileSigner(config.Comm.SSHPrivateKey)
-		if err != nil {
-			return nil, err
-		}
-
-		auth = append(auth, gossh.PublicKeys(signer))
-	}
-
-	return &gossh.ClientConfig{
-		User: config.Comm.SSHUsername,
-		Auth: auth,
-		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
-	}, nil
+	return hccommon.SSHClientConfig(config.Comm.SSHUsername, config.Comm.SSHPassword, config.Comm.SSHPrivateKeyFile)
 }
@@ -1,14 +1,14 @@
 package vnc
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math/rand"
 	"net"
 
-	"github.com/mitchellh/multistep"
-	"github.com/hashicorp/packer/packer"
-	"github.com/thehypercloud/apiclient-go"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/thehypercloud/packer-hypercloud/api"
 )
 
@@ -16,19 +16,20 @@ import (
 // It also creates the VNC session on the actual VM
 //
 // Uses:
-//   config *config
-//   ui     packer.Ui
+//
+//	config *config
+//	ui     packersdk.Ui
 //
 // Produces:
-//   vnc_port uint - The port that VNC is configured to listen on.
+//
+//	vnc_port uint - The port that VNC is configured to listen on.
 type stepConfigureVNC struct{}
 
-func (stepConfigureVNC) Run(state multistep.StateBag) multistep.StepAction {
+func (stepConfigureVNC) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	config := state.Get("config").(*Config)
-	ui := state.Get("ui").(packer.Ui)
-	client := state.Get("client").(*hypercloud.ApiClient)
-	instance := state.Get("instance").(map[string]interface{})
-	instanceId := instance["id"].(string)
+	ui := state.Get("ui").(packersdk.Ui)
+	client := state.Get("client").(*api.Client)
+	instance := state.Get("instance").(*api.Instance)
 
 	// Find an available port. Note that this can still fail later on
 	// because we have to release the port at some point. But this does its
@@ -50,9 +51,9 @@ func (stepConfigureVNC) Run(state multistep.StateBag) multistep.StepAction {
 
 	vncSession := api.ConsoleSession{
 		ConsoleType: "vnc",
-		InstanceID:  instanceId,
+		InstanceID:  instance.ID,
 	}
-	err := vncSession.Request(client, api.DEFAULT_TIMEOUT)
+	err := vncSession.Request(ctx, client, api.DEFAULT_TIMEOUT)
 	if err != nil {
 		state.Put("error", err)
 		ui.Error(err.Error())
@@ -1,22 +1,21 @@
 package vnc
 
 import (
-	"github.com/mitchellh/multistep"
-	"github.com/hashicorp/packer/packer"
-	"github.com/thehypercloud/apiclient-go"
+	"context"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/thehypercloud/packer-hypercloud/api"
 )
 
 // Boot the instance and wait for its state to be 'running'
 type stepDisableCDBoot struct{}
 
-func (s *stepDisableCDBoot) Run(state multistep.StateBag) multistep.StepAction {
-	client := state.Get("client").(*hypercloud.ApiClient)
-	ui := state.Get("ui").(packer.Ui)
-	instance := state.Get("instance").(map[string]interface{})
-	instanceId := instance["id"].(string)
+func (s *stepDisableCDBoot) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*api.Client)
+	ui := state.Get("ui").(packersdk.Ui)
+	instance := state.Get("instance").(*api.Instance)
 
-	instance, err := api.InstanceUpdate(client, instanceId, map[string]interface{}{
+	instance, err := api.InstanceUpdate(client, instance.ID, map[string]interface{}{
 		"boot_device": "disk",
 	})
 	if err != nil {
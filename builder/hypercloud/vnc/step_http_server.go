@@ -1,14 +1,15 @@
 package vnc
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math/rand"
 	"net"
 	"net/http"
 
-	"github.com/mitchellh/multistep"
-	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 )
 
 // This step creates and runs the HTTP server that is serving files from the
@@ -16,46 +17,31 @@ import (
 // template.
 //
 // Uses:
-//   config *config
-//   ui     packer.Ui
+//
+//	config *config
+//	ui     packersdk.Ui
 //
 // Produces:
-//   http_port int - The port the HTTP server started on.
+//
+//	http_port int - The port the HTTP server started on.
 type stepHTTPServer struct {
 	l net.Listener
 }
 
-func (s *stepHTTPServer) Run(state multistep.StateBag) multistep.StepAction {
+func (s *stepHTTPServer) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
 	config := state.Get("config").(*Config)
-	ui := state.Get("ui").(packer.Ui)
+	ui := state.Get("ui").(packersdk.Ui)
 
 	var httpPort uint = 0
 	if config.HTTPDir == "" {
 		ui.Say("Not starting HTTP server, http_directory not set")
-		state.Put("http_port", httpPort)
+		state.Put("http_port", int(httpPort))
 		return multistep.ActionContinue
 	}
 
 	// Find an available TCP port for our HTTP server
-	var httpAddr string
-	portRange := int(config.HTTPPortMax - config.HTTPPortMin)
-	for {
-		var err error
-		var offset uint = 0
-
-		if portRange > 0 {
-			// Intn will panic if portRange == 0, so we do a check.
-			offset = uint(rand.Intn(portRange))
-		}
-
-		httpPort = offset + config.HTTPPortMin
-		httpAddr = fmt.Sprintf(":%d", httpPort) // Listen on all IPs
-		log.Printf("Trying port: %d", httpPort)
-		s.l, err = net.Listen("tcp", httpAddr)
-		if err == nil {
-			break
-		}
-	}
+	s.l, httpPort = listenInRange(config.HTTPPortMin, config.HTTPPortMax)
+	httpAddr := fmt.Sprintf(":%d", httpPort)
 
 	ui.Say(fmt.Sprintf("Starting HTTP server on %s", httpAddr))
 
@@ -64,8 +50,9 @@ func (s *stepHTTPServer) Run(state multistep.StateBag) multistep.StepAction {
 	server := &http.Server{Addr: httpAddr, Handler: fileServer}
 	go server.Serve(s.l)
 
-	// Save the address into the state so it can be accessed in the future
-	state.Put("http_port", httpPort)
+	// Save the address into the state so it can be accessed in the future.
+	// It must be an int, as the provision hook reads it too.
+	state.Put("http_port", int(httpPort))
 
 	if config.HTTPIP == "" {
 		// Try and guess the IP by getting the first local IP
@@ -88,6 +75,27 @@ func (s *stepHTTPServer) Cleanup(multistep.StateBag) {
 	}
 }
 
+// listenInRange listens on all IPs on a free port between min and max,
+// trying ports at random until one is free
+func listenInRange(min uint, max uint) (net.Listener, uint) {
+	portRange := int(max - min)
+	for {
+		var offset uint = 0
+
+		if portRange > 0 {
+			// Intn will panic if portRange == 0, so we do a check.
+			offset = uint(rand.Intn(portRange))
+		}
+
+		port := offset + min
+		log.Printf("Trying port: %d", port)
+		l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+		if err == nil {
+			return l, port
+		}
+	}
+}
+
 func findFirstIP() (ip string, err error) {
 	addrs, err := net.InterfaceAddrs()
 
@@ -1,231 +1,106 @@
 package vnc
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"net/http"
-	"strconv"
-	"strings"
 	"time"
 
-	"github.com/mitchellh/multistep"
-	"github.com/hashicorp/packer/communicator/ssh"
-	"github.com/hashicorp/packer/packer"
-	"github.com/thehypercloud/apiclient-go"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/thehypercloud/packer-hypercloud/api"
+	hccommon "github.com/thehypercloud/packer-hypercloud/builder/hypercloud/common"
 )
 
-// Makes sure the boot disk is unattached and cdrom:true
-type stepPrepareBootDisk struct{}
+// How often to check on a boot disk being transferred by another build
+var bootDiskPollInterval = 15 * time.Second
+
+// Finds or transfers the cached boot disk, and makes a cdrom:true copy of
+// it for the build to boot from
+type stepPrepareBootDisk struct {
+	// The disk being downloaded to, until the download has completed
+	downloading *api.Disk
+	// The downloader VM launched for this build, until it is terminated
+	launched *hccommon.HelperInstance
+	// The build's copy of the boot disk
+	clone *api.Disk
+}
 
-func (s *stepPrepareBootDisk) Run(state multistep.StateBag) multistep.StepAction {
+func (s *stepPrepareBootDisk) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	config := state.Get("config").(*Config)
-	client := state.Get("client").(*hypercloud.ApiClient)
-	ui := state.Get("ui").(packer.Ui)
+	client := state.Get("client").(*api.Client)
+	ui := state.Get("ui").(packersdk.Ui)
 
-	// Check the disk tier exists, get its region
-	tier, err := api.FindDiskTier(client, config.DiskPerformanceTierID)
+	// Look up the tiers and network, and get the region from the disk tier
+	tier, err := config.LocationConfig.Resolve(client)
 	if err != nil {
 		state.Put("error", err)
+		ui.Error(err.Error())
 		return multistep.ActionHalt
 	}
-	region := tier["region"].(map[string]interface{})
-	config.regionId = region["id"].(string)
-	ui.Say(fmt.Sprintf("Disk performance tier found, in region %s", region["name"].(string)))
-
-	ui.Say("Preparing boot disk")
-	disks, err := api.DiskList(client)
-	var boot_disk map[string]interface{}
+	ui.Say(fmt.Sprintf("Disk performance tier found, in region %s", tier.Region.Name))
 
-	md5_substr := "md5=" + config.BootDiskMD5
-	for _, element := range disks {
-		name := element["name"].(string)
-		region := element["region"].(map[string]interface{})
-		if strings.Contains(name, md5_substr) && region["id"] == config.regionId {
-			boot_disk = element
-			break
-		}
+	config.checksums, err = config.bootChecksums()
+	if err != nil {
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
 	}
-	if boot_disk != nil {
-		ui.Say(fmt.Sprintf("Found boot disk with md5 in name: %s", boot_disk["id"]))
-	} else {
-		// Otherwise, we need to download from the supplied URL
 
-		// Sanity check that the URL works
-		ui.Say(fmt.Sprintf("Sanity checking the boot_disk_url exists: %s", config.BootDiskURL))
-		resp, err := http.Head(config.BootDiskURL)
-		if err != nil {
-			err := fmt.Errorf("Error checking the supplied boot disk URL: %s", err)
-			state.Put("error", err)
-			return multistep.ActionHalt
-		}
-		if resp.StatusCode != 200 {
-			err := fmt.Errorf("Error checking the supplied boot disk URL: Status code returned was %d, expected 200", resp.StatusCode)
-			state.Put("error", err)
-			return multistep.ActionHalt
-		}
-		size_header := resp.Header.Get("Content-Length")
-		if size_header == "" {
-			err := fmt.Errorf("Error checking the supplied boot_disk_url: No Content-Length header was present")
-			state.Put("error", err)
-			return multistep.ActionHalt
-		}
-		content_length, err := strconv.Atoi(size_header)
-		if err != nil {
-			err := fmt.Errorf("Error checking the supplied boot_disk_url: Content-Length header was not an integer: %s", size_header)
-			state.Put("error", err)
-			return multistep.ActionHalt
-		}
-		if content_length < (10 * 1024 * 1024) { // if smaller than 10 megabytes - arbitrary size that probably indicates not an ISO
-			err := fmt.Errorf("Error checking the supplied boot_disk_url: Content-Length is less than 10 MB - probably not an ISO")
-			state.Put("error", err)
-			return multistep.ActionHalt
-		}
-
-		// OK, the URL is probably fine.
-
-		// Find our downloader VM
-		ui.Say(fmt.Sprintf("Checking for downloader VM with ID: %s", config.DownloaderVMID))
-		downloader_vm, err := api.InstanceInfo(client, config.DownloaderVMID)
+	ui.Say("Preparing boot disk")
+	var boot_disk *api.Disk
+	var waiting string
+	deadline := time.Now().Add(config.bootDiskWaitTimeout)
+	for {
+		disks, err := api.DiskList(client)
 		if err != nil {
-			err := fmt.Errorf("Error getting info for Download VM: %s", err)
+			err := fmt.Errorf("Error listing disks: %s", err)
 			state.Put("error", err)
+			ui.Error(err.Error())
 			return multistep.ActionHalt
 		}
 
-		// Create the new disk
-		ui.Say("Creating blank disk to be used as the boot disk")
-		boot_disk, err = api.CreateBlankDisk(client, 10, "Downloading... "+config.PackerBuildName, config.regionId, config.DiskPerformanceTierID)
-		if err != nil {
-			err := fmt.Errorf("Error creating new blank disk for boot disk via api: %s", err)
-			state.Put("error", err)
-			return multistep.ActionHalt
+		var sum *checksum
+		if boot_disk, sum = cachedBootDisk(disks, config); boot_disk != nil {
+			ui.Say(fmt.Sprintf("Found boot disk with %s in name: %s", sum.Type, boot_disk.ID))
+			break
 		}
 
-		// Attach to downloader VM
-		ui.Say("Attaching the new disk to the downloader VM")
-		err = api.InstanceAddDisk(client, config.DownloaderVMID, boot_disk["id"].(string))
-		if err != nil {
-			err := fmt.Errorf("Error attaching new boot disk to downloader VM: %s", err)
-			state.Put("error", err)
-			return multistep.ActionHalt
-		}
-		// Boot the downloader if not already running
-		if downloader_vm["state"].(string) == "stopped" {
-			ui.Say("Booting downloader vm")
-			err := api.InstanceStart(client, downloader_vm["id"].(string), api.DEFAULT_TIMEOUT)
-			if err != nil {
-				err := fmt.Errorf("Error starting download vm: %s", err)
+		// Wait for another build already transferring the same ISO
+		if claims := bootDiskClaims(disks, config); len(claims) > 0 {
+			if time.Now().After(deadline) {
+				err := fmt.Errorf("Timed out after %s waiting for another build to transfer the boot disk to disk %s (%s). If that build is no longer running, delete the disk.",
+					config.bootDiskWaitTimeout, claims[0].ID, claims[0].Name)
 				state.Put("error", err)
+				ui.Error(err.Error())
 				return multistep.ActionHalt
 			}
-			time.Sleep(30)
-		}
-		// Get the disk position in the downloader VM
-		downloader_vm, err = api.InstanceInfo(client, config.DownloaderVMID)
-		if err != nil {
-			err := fmt.Errorf("Error getting info for Download VM: %s", err)
-			state.Put("error", err)
-			return multistep.ActionHalt
-		}
-		instance_disks := downloader_vm["disks"].([]interface{})
-		boot_disk_index := -1
-		for _, element := range instance_disks {
-			current_disk := element.(map[string]interface{})
-			if current_disk["id"] == boot_disk["id"] {
-				boot_disk_index = int(current_disk["position"].(float64))
-				break
+			if claims[0].ID != waiting {
+				waiting = claims[0].ID
+				ui.Say(fmt.Sprintf("Waiting for another build to transfer the boot disk to disk %s (%s)", claims[0].ID, claims[0].Name))
 			}
-		}
-		if boot_disk_index == -1 {
-			err := fmt.Errorf("Couldn't find index of disk %s attached to instance %s", boot_disk["id"], downloader_vm["id"])
-			state.Put("error", err)
-			return multistep.ActionHalt
-		}
-
-		// Just get the first IP address of the downloader VM
-		adapters := downloader_vm["network_adapters"].([]interface{})
-		first_adapter := adapters[0].(map[string]interface{})
-		ips := first_adapter["ip_addresses"].([]interface{})
-		first_ip := ips[0].(map[string]interface{})
-		ip_address := first_ip["address"].(string)
-		ssh_address := ip_address + ":22"
-
-		// Turn a disk position into device path, e.g. position 1 = /dev/xvdb
-		target_device := fmt.Sprintf("/dev/xvd%c", 97+boot_disk_index) // asccii char: starting at 'a' for 0 index
-
-		// Connect to downloader VM over SSH
-		ssh_config, err := sshConfig(state)
-		connFunc := ssh.ConnectFunc("tcp", ssh_address)
-		nc, err := connFunc()
-		if err != nil {
-			err = fmt.Errorf("Connecting to Downloader VM failed: TCP connection to SSH ip/port failed: %s", err)
-			state.Put("error", err)
-			return multistep.ActionHalt
-		}
-		nc.Close()
-
-		// Then we attempt to connect via SSH
-		ssh_connection := &ssh.Config{
-			Connection: connFunc,
-			SSHConfig:  ssh_config,
-			Pty:        true,
-		}
-		comm, err := ssh.New(ssh_address, ssh_connection)
-		if err != nil {
-			err = fmt.Errorf("Connecting to Downloader VM failed: %s", err)
-			state.Put("error", err)
-			return multistep.ActionHalt
-		}
-
-		ui.Say("Running SSH command to download file and dd to boot disk")
-		command := fmt.Sprintf("wget %s -qO- > %s && if [ $(dd if=%s | head -c %d | md5sum | cut -d ' ' -f1) != \"%s\" ]; then echo 'md5 does not match'; exit 111; fi",
-			config.BootDiskURL, target_device, target_device, content_length, config.BootDiskMD5)
-		ui.Say(command)
-		stdout := new(bytes.Buffer)
-		stderr := new(bytes.Buffer)
-		remoteCmd := &packer.RemoteCmd{
-			Command: command,
-			Stdout:  stdout,
-			Stderr:  stderr,
-		}
-		err = comm.Start(remoteCmd)
-		if err != nil {
-			err = fmt.Errorf("Error starting download command: %s", err)
-			state.Put("error", err)
-			return multistep.ActionHalt
-		}
-
-		remoteCmd.Wait()
-
-		if remoteCmd.ExitStatus != 0 {
-			err = fmt.Errorf("Got exit status %d from downloader SSH command, expected 0. Stdout: %s. Stderr: %s", remoteCmd.ExitStatus, stdout.String(), stderr.String())
-			state.Put("error", err)
-			return multistep.ActionHalt
+			if err := api.Sleep(ctx, bootDiskPollInterval); err != nil {
+				state.Put("error", err)
+				return multistep.ActionHalt
+			}
+			continue
 		}
 
-		// Rename the disk to the builder name, and include the MD5 hash
-		boot_disk, err = api.UpdateDisk(client, boot_disk["id"].(string), map[string]interface{}{
-			"name": config.PackerBuildName + " " + md5_substr,
-		})
-		if err != nil {
-			err = fmt.Errorf("Error renaming boot_disk: %s", err)
-			state.Put("error", err)
-			return multistep.ActionHalt
+		// Otherwise, we need to transfer it from the supplied URL
+		boot_disk, err = s.transfer(state)
+		if err == errClaimLost {
+			continue
 		}
-
-		// Live detach the boot disk from downloader VM
-		err = api.InstanceRemoveDisk(client, downloader_vm["id"].(string), boot_disk["id"].(string))
 		if err != nil {
-			err = fmt.Errorf("Error live detaching boot disk from instance: %s", err)
 			state.Put("error", err)
+			ui.Error(err.Error())
 			return multistep.ActionHalt
 		}
+		break
 	}
 
 	// This step continues either from downloading the disk, or it already being ready
 	// Get up-to-date information on the boot_disk, referred to as 'disk' from here
-	disk, err := api.DiskInfo(client, boot_disk["id"].(string))
+	disk, err := api.DiskInfo(client, boot_disk.ID)
 	if err != nil {
 		err := fmt.Errorf("Error preparing boot disk: couldn't get disk info: %s", err)
 		state.Put("error", err)
@@ -233,30 +108,23 @@ func (s *stepPrepareBootDisk) Run(state multistep.StateBag) multistep.StepAction
 		return multistep.ActionHalt
 	}
 
-	// Detach from a VM if already attached
-	if disk["instance_id"] != nil {
-		instance_id := disk["instance_id"].(string)
-		ui.Say(fmt.Sprintf("Disk is attached to instance %s", instance_id))
-		instance, err := api.InstanceInfo(client, instance_id)
-		if err != nil {
-			err := fmt.Errorf("Error preparing boot disk: couldn't get info about instance it is already attached to: %s", err, instance)
-			state.Put("error", err)
-			ui.Error(err.Error())
-			return multistep.ActionHalt
-		}
-		if instance["state"] == "stopped" {
-			ui.Say("instance is stopped, doing a quick non-live disk detach")
-			err = api.InstanceRemoveDisk(client, instance_id, disk["id"].(string))
-		} else {
-			err := fmt.Errorf("Error preparing boot disk: already attached to an instance %s in state %s", disk["instance_id"], instance["state"])
-			state.Put("error", err)
-			ui.Error(err.Error())
-			return multistep.ActionHalt
-		}
+	// Each build boots from its own copy of the cached boot disk, so that
+	// any number of builds can use it at once
+	ui.Say(fmt.Sprintf("Copying boot disk %s for this build", disk.ID))
+	clone, err := api.CopyDisk(ctx, client, disk.ID, hccommon.BuildResourcePrefix+config.PackerBuildName+" boot disk",
+		config.RegionID(), config.DiskPerformanceTierID, config.BuildTags())
+	if clone != nil {
+		s.clone = clone
+	}
+	if err != nil {
+		err := fmt.Errorf("Error copying boot disk: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
 	}
 
-	// Set disk.cdrom = true
-	disk, err = api.UpdateDisk(client, disk["id"].(string), map[string]interface{}{
+	// Set cdrom = true on the copy
+	clone, err = api.UpdateDisk(client, clone.ID, map[string]interface{}{
 		"cdrom": true,
 	})
 	if err != nil {
@@ -266,11 +134,52 @@ func (s *stepPrepareBootDisk) Run(state multistep.StateBag) multistep.StepAction
 		return multistep.ActionHalt
 	}
 
-	state.Put("boot_disk", disk)
+	state.Put("boot_disk_source", disk)
+	state.Put("boot_disk", clone)
 	return multistep.ActionContinue
 }
 
+// A completed boot disk is kept to be re-used by later builds, but a
+// partial download is detached and deleted, as is the build's
+// copy. A downloader VM launched for the build is always terminated.
 func (s *stepPrepareBootDisk) Cleanup(state multistep.StateBag) {
-	// No cleanup, disk can be re-used later
-	// TODO: remove the disk if it's still got 'Downloading' in the name
+	if s.launched != nil {
+		s.launched.Destroy(state)
+		s.launched = nil
+	}
+	s.discard(state)
+	if s.clone != nil {
+		deleteBootDisk(state, s.clone.ID)
+		s.clone = nil
+	}
+}
+
+// discard detaches and deletes the disk of an incomplete transfer
+func (s *stepPrepareBootDisk) discard(state multistep.StateBag) {
+	if s.downloading == nil {
+		return
+	}
+	id := s.downloading.ID
+	s.downloading = nil
+	deleteBootDisk(state, id)
+}
+
+// deleteBootDisk detaches a disk from any instance it is attached to, and
+// deletes it
+func deleteBootDisk(state multistep.StateBag, id string) {
+	client := state.Get("client").(*api.Client).WithContext(context.Background())
+	ui := state.Get("ui").(packersdk.Ui)
+
+	disk, err := api.DiskInfo(client, id)
+	if api.IsNotFound(err) {
+		return
+	}
+	if err == nil && disk.InstanceID != "" {
+		ui.Say(fmt.Sprintf("Detaching boot disk %s from instance %s", disk.ID, disk.InstanceID))
+		err = api.InstanceRemoveDisk(context.Background(), client, disk.InstanceID, disk.ID)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Error detaching boot disk %s: %s", disk.ID, err))
+		}
+	}
+	hccommon.DeleteDisk(state, id)
 }
@@ -1,37 +1,47 @@
 package vnc
 
 import (
+	"context"
 	"fmt"
 
-	"github.com/mitchellh/multistep"
-	"github.com/hashicorp/packer/packer"
-	"github.com/thehypercloud/apiclient-go"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/thehypercloud/packer-hypercloud/api"
+	hccommon "github.com/thehypercloud/packer-hypercloud/builder/hypercloud/common"
 )
 
 // This step creates the disk that will be used as the
 // hard drive for the virtual machine.
 type stepCreateDisk struct{}
 
-func (s *stepCreateDisk) Run(state multistep.StateBag) multistep.StepAction {
+func (s *stepCreateDisk) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	config := state.Get("config").(*Config)
-	client := state.Get("client").(*hypercloud.ApiClient)
-	ui := state.Get("ui").(packer.Ui)
+	client := state.Get("client").(*api.Client)
+	ui := state.Get("ui").(packersdk.Ui)
 
-	diskName := "Packer in-progress: " + config.PackerBuildName
+	diskName := hccommon.InProgressDiskPrefix + config.PackerBuildName
 	ui.Say(fmt.Sprintf("Creating blank target disk with name %s", diskName))
-	disk, err := api.CreateBlankDisk(client, config.DiskSize, diskName, config.regionId, config.DiskPerformanceTierID)
+	disk, err := api.CreateBlankDisk(ctx, client, config.DiskSize, diskName, config.RegionID(), config.DiskPerformanceTierID, config.BuildTags())
+	if disk != nil {
+		state.Put("disk", disk)
+	}
 	if err != nil {
-		err := fmt.Errorf("Error creating target blank disk via api: %s: %s", err, disk)
+		err := fmt.Errorf("Error creating target blank disk via api: %s", err)
 		state.Put("error", err)
 		ui.Error(err.Error())
 		return multistep.ActionHalt
 	}
-	ui.Say(fmt.Sprintf("Target disk created with id: %s", disk["id"]))
-	state.Put("disk", disk)
+	ui.Say(fmt.Sprintf("Target disk created with id: %s", disk.ID))
 	return multistep.ActionContinue
 }
 
+// Delete the half-built target disk if the build failed. On success it is
+// the artifact.
 func (s *stepCreateDisk) Cleanup(state multistep.StateBag) {
-	// TODO: delete disk
+	if !hccommon.Halted(state) {
+		return
+	}
+	if disk, ok := state.GetOk("disk"); ok {
+		hccommon.DeleteDisk(state, disk.(*api.Disk).ID)
+	}
 }
@@ -1,6 +1,7 @@
 package vnc
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
@@ -9,11 +10,11 @@ import (
 	"unicode"
 	"unicode/utf8"
 
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
 	"github.com/mcclymont/tcp2ws-go"
 	"github.com/mitchellh/go-vnc"
-	"github.com/mitchellh/multistep"
-	"github.com/hashicorp/packer/packer"
-	"github.com/hashicorp/packer/template/interpolate"
 	"github.com/thehypercloud/packer-hypercloud/api"
 )
 
@@ -21,7 +22,7 @@ const KeyLeftShift uint32 = 0xFFE1
 
 type bootCommandTemplateData struct {
 	HTTPIP             string
-	HTTPPort           uint
+	HTTPPort           int
 	Name               string
 	HYPERCLOUD_IP      string
 	HYPERCLOUD_NETMASK string
@@ -32,22 +33,41 @@ type bootCommandTemplateData struct {
 // This step "types" the boot command into the VM over VNC.
 //
 // Uses:
-//   config *config
-//   http_port int
-//   ui     packer.Ui
-//   vnc_port uint
+//
+//	config *config
+//	http_port int
+//	ui     packersdk.Ui
+//	vnc_port uint
 //
 // Produces:
-//   <nothing>
+//
+//	<nothing>
 type stepTypeBootCommand struct{}
 
-func (s *stepTypeBootCommand) Run(state multistep.StateBag) multistep.StepAction {
+func (s *stepTypeBootCommand) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
 	config := state.Get("config").(*Config)
-	httpPort := state.Get("http_port").(uint)
-	ui := state.Get("ui").(packer.Ui)
+	client := state.Get("client").(*api.Client)
+	httpPort := state.Get("http_port").(int)
+	ip := state.Get("ip").(*api.IPAddress)
+	ui := state.Get("ui").(packersdk.Ui)
 	vncSession := state.Get("vnc_session").(api.ConsoleSession)
 	vncProxyPort := state.Get("vnc_proxy_port").(uint)
 
+	// The instance's address, for the installer's network configuration
+	network, err := api.NetworkInfo(client, config.NetworkID)
+	if err != nil {
+		err := fmt.Errorf("Error getting network info: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	cidr, err := network.PrefixLength()
+	if err != nil {
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
 	// Connect to VNC
 	ui.Say("Connecting to VM via VNC")
 
@@ -85,10 +105,10 @@ func (s *stepTypeBootCommand) Run(state multistep.StateBag) multistep.StepAction
 		config.HTTPIP,
 		httpPort,
 		config.PackerBuildName,
-		config.HYPERCLOUD_IP,
-		config.HYPERCLOUD_NETMASK,
-		config.HYPERCLOUD_CIDR,
-		config.HYPERCLOUD_GATEWAY,
+		ip.Address,
+		network.Netmask,
+		cidr,
+		network.Gateway,
 	}
 
 	ui.Say("Typing the boot command over VNC...")
@@ -1,6 +0,0 @@
-// hypercloud-packer project doc.go
-
-/*
-hypercloud-packer document
-*/
-package main
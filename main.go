@@ -0,0 +1,32 @@
+// Command packer-plugin-hypercloud is the HyperCloud plugin for Packer. It
+// serves the clone and vnc builders and the export, prune and region-copy
+// post-processors, which templates name hypercloud-clone, hypercloud-vnc,
+// hypercloud-export and so on.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/packer-plugin-sdk/plugin"
+	"github.com/thehypercloud/packer-hypercloud/builder/hypercloud/clone"
+	"github.com/thehypercloud/packer-hypercloud/builder/hypercloud/vnc"
+	export "github.com/thehypercloud/packer-hypercloud/post-processor/hypercloud-export"
+	prune "github.com/thehypercloud/packer-hypercloud/post-processor/hypercloud-prune"
+	regioncopy "github.com/thehypercloud/packer-hypercloud/post-processor/hypercloud-region-copy"
+	"github.com/thehypercloud/packer-hypercloud/version"
+)
+
+func main() {
+	pps := plugin.NewSet()
+	pps.RegisterBuilder("clone", new(clone.Builder))
+	pps.RegisterBuilder("vnc", new(vnc.Builder))
+	pps.RegisterPostProcessor("export", new(export.PostProcessor))
+	pps.RegisterPostProcessor("prune", new(prune.PostProcessor))
+	pps.RegisterPostProcessor("region-copy", new(regioncopy.PostProcessor))
+	pps.SetVersion(version.PluginVersion)
+	if err := pps.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
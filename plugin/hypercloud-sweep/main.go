@@ -0,0 +1,106 @@
+// Command hypercloud-sweep finds the instances, disks and IP addresses left
+// behind by Packer builds that crashed before they could clean up, and
+// optionally deletes them.
+//
+// By default it only lists what it finds. Pass -delete to delete them.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/thehypercloud/packer-hypercloud/api"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	var (
+		url         = flag.String("url", os.Getenv("HYPERCLOUD_URL"), "Base URL of the HyperCloud API")
+		id          = flag.String("id", os.Getenv("HYPERCLOUD_ID"), "ID of the application used to authenticate")
+		secret      = flag.String("secret", os.Getenv("HYPERCLOUD_SECRET"), "Secret used with -id to authenticate")
+		accessToken = flag.String("access-token", os.Getenv("HYPERCLOUD_ACCESS_TOKEN"), "Access token used to authenticate")
+		olderThan   = flag.Duration("older-than", 24*time.Hour, "Only sweep resources created at least this long ago")
+		remove      = flag.Bool("delete", false, "Delete the resources found, instead of only listing them")
+		asJSON      = flag.Bool("json", false, "Print the results as JSON")
+		retries     = flag.Int("retries", 3, "Times to retry an API call that failed with a transient error")
+	)
+	flag.Parse()
+
+	if *url == "" {
+		fmt.Fprintln(os.Stderr, "-url or HYPERCLOUD_URL is required")
+		return 2
+	}
+	if *accessToken == "" && (*id == "" || *secret == "") {
+		fmt.Fprintln(os.Stderr, "either -access-token or both -id and -secret are required")
+		return 2
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+
+	client := api.Connect(api.Endpoint{URL: *url, ID: *id, Secret: *secret, AccessToken: *accessToken})
+	client.Context = ctx
+	client.Retry = api.RetryPolicy{MaxRetries: *retries, Timeout: 5 * time.Minute}
+
+	orphans, err := findOrphans(client, *olderThan, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing resources: %s\n", err)
+		return 1
+	}
+	failed := false
+	if *remove {
+		failed = deleteOrphans(ctx, client, orphans)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(orphans); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output: %s\n", err)
+			return 1
+		}
+	} else {
+		printOrphans(orphans)
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func printOrphans(orphans []orphan) {
+	if len(orphans) == 0 {
+		fmt.Println("No orphaned resources found.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tID\tNAME\tAGE\tACTION")
+	for _, o := range orphans {
+		age := o.Age
+		if age == "" {
+			age = "unknown"
+		}
+		action := o.Action
+		if o.Error != "" {
+			action += ": " + o.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", o.Kind, o.ID, o.Name, age, action)
+	}
+	w.Flush()
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/thehypercloud/packer-hypercloud/api"
+	hccommon "github.com/thehypercloud/packer-hypercloud/builder/hypercloud/common"
+)
+
+// Actions reported for each orphan
+const (
+	actionFound      = "found"
+	actionSkipped    = "skipped: creation time unknown"
+	actionDeleted    = "deleted"
+	actionFailed     = "failed"
+	actionNotDeleted = "not deleted"
+)
+
+type orphan struct {
+	Kind      string     `json:"kind"`
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	Age       string     `json:"age,omitempty"`
+	Action    string     `json:"action"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// isBuildName reports whether name is one given to a resource by a build
+// which has not finished. Boot disks copied from the cache are named like
+// instances, so every kind is matched against BuildResourcePrefix.
+func isBuildName(kind string, name string) bool {
+	if strings.HasPrefix(name, hccommon.BuildResourcePrefix) {
+		return true
+	}
+	if kind == "disk" {
+		return strings.HasPrefix(name, hccommon.InProgressDiskPrefix) ||
+			strings.HasPrefix(name, hccommon.DownloadingDiskPrefix)
+	}
+	return false
+}
+
+// isArtifact reports whether tags mark a resource as a build's artifact,
+// which is never swept whatever it is named
+func isArtifact(tags api.Tags) bool {
+	return tags[hccommon.TagArtifact] == "true"
+}
+
+func newOrphan(kind string, id string, name string, tags api.Tags, created api.Timestamp, olderThan time.Duration, now time.Time) (orphan, bool) {
+	if !isBuildName(kind, name) || isArtifact(tags) {
+		return orphan{}, false
+	}
+	o := orphan{Kind: kind, ID: id, Name: name, Action: actionFound}
+	if created.IsZero() {
+		// Without a creation time a resource may belong to a running build,
+		// so only sweep it when asked to ignore age altogether
+		if olderThan > 0 {
+			o.Action = actionSkipped
+		}
+		return o, true
+	}
+	age := now.Sub(created.Time)
+	if age < olderThan {
+		return orphan{}, false
+	}
+	createdAt := created.Time
+	o.CreatedAt = &createdAt
+	o.Age = (age / time.Second * time.Second).String()
+	return o, true
+}
+
+// findOrphans lists the instances, then ip addresses, then disks named by
+// a build, not tagged as an artifact and created at least olderThan ago. That is also the order they
+// must be deleted in.
+func findOrphans(client *api.Client, olderThan time.Duration, now time.Time) ([]orphan, error) {
+	var orphans []orphan
+
+	instances, err := api.InstanceList(client)
+	if err != nil {
+		return nil, err
+	}
+	for _, instance := range instances {
+		if instance.State == "terminated" {
+			continue
+		}
+		if o, ok := newOrphan("instance", instance.ID, instance.Name, instance.Tags, instance.CreatedAt, olderThan, now); ok {
+			orphans = append(orphans, o)
+		}
+	}
+
+	ips, err := api.IPAddressList(client)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if o, ok := newOrphan("ip address", ip.ID, ip.Name, ip.Tags, ip.CreatedAt, olderThan, now); ok {
+			orphans = append(orphans, o)
+		}
+	}
+
+	disks, err := api.DiskList(client)
+	if err != nil {
+		return nil, err
+	}
+	for _, disk := range disks {
+		if o, ok := newOrphan("disk", disk.ID, disk.Name, disk.Tags, disk.CreatedAt, olderThan, now); ok {
+			orphans = append(orphans, o)
+		}
+	}
+
+	return orphans, nil
+}
+
+// deleteOrphans deletes every orphan that was found, updating its action,
+// and reports whether any deletion failed.
+func deleteOrphans(ctx context.Context, client *api.Client, orphans []orphan) (failed bool) {
+	for i := range orphans {
+		o := &orphans[i]
+		if o.Action != actionFound {
+			continue
+		}
+		if ctx.Err() != nil {
+			o.Action = actionNotDeleted
+			o.Error = "interrupted"
+			failed = true
+			continue
+		}
+
+		var err error
+		switch o.Kind {
+		case "instance":
+			err = deleteInstance(ctx, client, o.ID)
+		case "ip address":
+			err = api.DeallocateIP(client, o.ID)
+		case "disk":
+			err = deleteDisk(ctx, client, o.ID)
+		}
+		if err != nil && !api.IsNotFound(err) {
+			o.Action = actionFailed
+			o.Error = err.Error()
+			failed = true
+			continue
+		}
+		o.Action = actionDeleted
+	}
+	return failed
+}
+
+// deleteInstance detaches everything from an instance, so that disks which
+// don't belong to the build (e.g. a cached boot ISO) survive, and
+// terminates it.
+func deleteInstance(ctx context.Context, client *api.Client, id string) error {
+	if err := api.InstanceUpdateDisks(ctx, client, id, make([]string, 0)); err != nil {
+		return err
+	}
+	if err := api.InstanceRemoveNetworks(client, id); err != nil {
+		return err
+	}
+	return api.InstanceTerminate(ctx, client, id, api.DEFAULT_TIMEOUT, true)
+}
+
+// deleteDisk deletes a disk, first detaching it from any instance still
+// using it, e.g. a partial download attached to the downloader VM.
+func deleteDisk(ctx context.Context, client *api.Client, id string) error {
+	disk, err := api.DiskInfo(client, id)
+	if err != nil {
+		return err
+	}
+	if disk.InstanceID != "" {
+		if err := api.InstanceRemoveDisk(ctx, client, disk.InstanceID, disk.ID); err != nil {
+			return err
+		}
+	}
+	return api.DiskDelete(client, id)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/thehypercloud/packer-hypercloud/api"
+	"github.com/thehypercloud/packer-hypercloud/api/hypercloudtest"
+	hccommon "github.com/thehypercloud/packer-hypercloud/builder/hypercloud/common"
+)
+
+func TestNewOrphan(t *testing.T) {
+	now := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	old := api.Timestamp{Time: now.Add(-48 * time.Hour)}
+	recent := api.Timestamp{Time: now.Add(-time.Hour)}
+	artifact := api.Tags{hccommon.TagArtifact: "true"}
+
+	for _, tc := range []struct {
+		name      string
+		kind      string
+		resource  string
+		tags      api.Tags
+		created   api.Timestamp
+		olderThan time.Duration
+		want      string // the action, or "" if not an orphan
+	}{
+		{"build instance", "instance", hccommon.BuildResourcePrefix + "web", nil, old, 24 * time.Hour, actionFound},
+		{"build ip address", "ip address", hccommon.BuildResourcePrefix + "web", nil, old, 24 * time.Hour, actionFound},
+		{"boot disk copy", "disk", hccommon.BuildResourcePrefix + "web", nil, old, 24 * time.Hour, actionFound},
+		{"in progress disk", "disk", hccommon.InProgressDiskPrefix + "web", nil, old, 24 * time.Hour, actionFound},
+		{"downloading disk", "disk", hccommon.DownloadingDiskPrefix + "ubuntu.iso", nil, old, 24 * time.Hour, actionFound},
+		{"in progress prefix on an instance", "instance", hccommon.InProgressDiskPrefix + "web", nil, old, 24 * time.Hour, ""},
+		{"other name", "disk", "database", nil, old, 24 * time.Hour, ""},
+		{"tagged artifact", "disk", hccommon.InProgressDiskPrefix + "web", artifact, old, 24 * time.Hour, ""},
+		{"artifact tag not true", "disk", hccommon.InProgressDiskPrefix + "web", api.Tags{hccommon.TagArtifact: "false"}, old, 24 * time.Hour, actionFound},
+		{"too recent", "disk", hccommon.InProgressDiskPrefix + "web", nil, recent, 24 * time.Hour, ""},
+		{"recent with no age limit", "disk", hccommon.InProgressDiskPrefix + "web", nil, recent, 0, actionFound},
+		{"creation time unknown", "disk", hccommon.InProgressDiskPrefix + "web", nil, api.Timestamp{}, 24 * time.Hour, actionSkipped},
+		{"creation time unknown with no age limit", "disk", hccommon.InProgressDiskPrefix + "web", nil, api.Timestamp{}, 0, actionFound},
+	} {
+		o, ok := newOrphan(tc.kind, "id", tc.resource, tc.tags, tc.created, tc.olderThan, now)
+		got := ""
+		if ok {
+			got = o.Action
+		}
+		if got != tc.want {
+			t.Errorf("%s: action %q, want %q", tc.name, got, tc.want)
+		}
+		if ok && !tc.created.IsZero() && (o.CreatedAt == nil || o.Age == "") {
+			t.Errorf("%s: creation time and age not reported", tc.name)
+		}
+	}
+}
+
+func TestFindAndDeleteOrphans(t *testing.T) {
+	srv := hypercloudtest.NewServer()
+	defer srv.Close()
+	f := srv.Seed()
+	client := srv.Client()
+
+	orphanDisk := srv.AddDisk(f.RegionID, hccommon.InProgressDiskPrefix+"web", 10)
+	downloading := srv.AddDisk(f.RegionID, hccommon.DownloadingDiskPrefix+"ubuntu.iso", 1)
+	bootDisk := srv.AddDisk(f.RegionID, "ubuntu.iso sha256=abc", 1)
+	orphanInstance := srv.AddInstance(f.RegionID, hccommon.BuildResourcePrefix+"web", "running", downloading, bootDisk)
+	recent := srv.AddDisk(f.RegionID, hccommon.InProgressDiskPrefix+"running build", 10)
+	artifact := srv.AddDisk(f.RegionID, hccommon.InProgressDiskPrefix+"artifact", 10)
+	if _, err := api.UpdateDisk(client, artifact, map[string]interface{}{
+		"tags": map[string]string{hccommon.TagArtifact: "true"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{orphanDisk, downloading, bootDisk, orphanInstance, artifact, f.DownloaderID, f.DownloaderDiskID} {
+		srv.Backdate(id, 48*time.Hour)
+	}
+
+	orphans, err := findOrphans(client, 24*time.Hour, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for _, o := range orphans {
+		if o.Action != actionFound {
+			t.Errorf("%s %s: action %q", o.Kind, o.ID, o.Action)
+		}
+		found = append(found, o.ID)
+	}
+	// Instances come first, as they must be deleted before their disks
+	disks := []string{orphanDisk, downloading}
+	sort.Strings(disks)
+	if len(found) == 3 {
+		sort.Strings(found[1:])
+	}
+	if want := append([]string{orphanInstance}, disks...); !reflect.DeepEqual(found, want) {
+		t.Fatalf("found %v, want %v", found, want)
+	}
+
+	if failed := deleteOrphans(context.Background(), client, orphans); failed {
+		t.Fatalf("deleteOrphans failed: %+v", orphans)
+	}
+	for _, o := range orphans {
+		if o.Action != actionDeleted {
+			t.Errorf("%s %s: action %q, want %q", o.Kind, o.ID, o.Action, actionDeleted)
+		}
+	}
+	if inst, ok := srv.Instance(orphanInstance); ok && inst.State != "terminated" {
+		t.Errorf("instance %s is %s, want it terminated", orphanInstance, inst.State)
+	}
+	for _, id := range []string{orphanDisk, downloading} {
+		if _, ok := srv.Disk(id); ok {
+			t.Errorf("disk %s was not deleted", id)
+		}
+	}
+	// Disks that aren't the build's survive its instance being swept
+	for _, id := range []string{bootDisk, recent, artifact, f.DownloaderDiskID} {
+		if _, ok := srv.Disk(id); !ok {
+			t.Errorf("disk %s was deleted", id)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package export
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	builderID = "hypercloud.export"
+)
+
+// Artifact is a local copy of a disk's contents
+type Artifact struct {
+	path        string
+	diskID      string
+	format      string
+	compression string
+	sha256      string // of the file
+	rawSHA256   string // of the disk's contents
+}
+
+func (*Artifact) BuilderId() string {
+	return builderID
+}
+
+func (a *Artifact) Files() []string {
+	return []string{a.path}
+}
+
+func (a *Artifact) Id() string {
+	return a.path
+}
+
+func (a *Artifact) String() string {
+	return fmt.Sprintf("Disk %s exported to: %s", a.diskID, a.path)
+}
+
+func (a *Artifact) State(name string) interface{} {
+	switch name {
+	case "disk_id":
+		return a.diskID
+	case "format":
+		return a.format
+	case "compression":
+		return a.compression
+	case "sha256":
+		return a.sha256
+	case "raw_sha256":
+		return a.rawSHA256
+	}
+	return nil
+}
+
+func (a *Artifact) Destroy() error {
+	err := os.Remove(a.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package export
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// convert converts the raw image to the output's format and compression,
+// and returns the sha256 of the output. If the raw image is the output, it
+// returns "".
+func convert(ui packersdk.Ui, raw string, output string, format string, compression string) (string, error) {
+	if raw == output {
+		return "", nil
+	}
+
+	image := raw
+	if format == FormatQcow2 {
+		image = output
+		if compression != CompressionNone {
+			image = output + ".tmp.qcow2"
+			defer os.Remove(image)
+		}
+		ui.Say("Converting the image to qcow2")
+		if err := command("qemu-img", "convert", "-f", "raw", "-O", "qcow2", raw, image); err != nil {
+			return "", err
+		}
+	}
+
+	switch compression {
+	case CompressionGzip:
+		ui.Say("Compressing the image with gzip")
+		if err := gzipFile(image, output); err != nil {
+			return "", fmt.Errorf("Error compressing %s: %w", image, err)
+		}
+	case CompressionZstd:
+		ui.Say("Compressing the image with zstd")
+		if err := command("zstd", "-q", "-f", "-o", output, image); err != nil {
+			return "", err
+		}
+	}
+	return fileSHA256(output)
+}
+
+// command runs a local command, which must be on the PATH
+func command(name string, args ...string) error {
+	if _, err := exec.LookPath(name); err != nil {
+		return fmt.Errorf("%s must be installed to export in this format: %w", name, err)
+	}
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Error running %s: %s: %s", name, err, out)
+	}
+	return nil
+}
+
+func gzipFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
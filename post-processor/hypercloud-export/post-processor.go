@@ -0,0 +1,381 @@
+// Package export contains a post-processor that copies a disk built by the
+// HyperCloud builders to a local file, through a helper instance that the
+// disk is attached to and read from over SSH.
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/thehypercloud/packer-hypercloud/api"
+	hccommon "github.com/thehypercloud/packer-hypercloud/builder/hypercloud/common"
+)
+
+const (
+	FormatRaw   = "raw"
+	FormatQcow2 = "qcow2"
+
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// DefaultOutput is the file written when output is not set
+const DefaultOutput = "output-{{.BuildName}}/{{.DiskID}}.{{.Extension}}"
+
+var exportableBuilderIDs = map[string]bool{
+	hccommon.CloneBuilderID: true,
+	hccommon.VNCBuilderID:   true,
+}
+
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+
+type Config struct {
+	common.PackerConfig     `mapstructure:",squash"`
+	hccommon.AccessConfig   `mapstructure:",squash"`
+	hccommon.LocationConfig `mapstructure:",squash"`
+
+	Output               string `mapstructure:"output"`
+	Format               string `mapstructure:"format"`
+	Compression          string `mapstructure:"compression"`
+	Force                bool   `mapstructure:"force"`
+	ExporterVMID         string `mapstructure:"exporter_vm_id"`
+	ExporterTemplateID   string `mapstructure:"exporter_template_id"`
+	ExporterTemplateName string `mapstructure:"exporter_template_name"`
+	ExporterTemplateSlug string `mapstructure:"exporter_template_slug"`
+	SSHUsername          string `mapstructure:"ssh_username"`
+	SSHPassword          string `mapstructure:"ssh_password"`
+	SSHPrivateKey        string `mapstructure:"ssh_private_key_file"`
+
+	ctx interpolate.Context
+}
+
+func (c *Config) exporterTemplate() hccommon.TemplateSource {
+	return hccommon.TemplateSource{ID: c.ExporterTemplateID, Slug: c.ExporterTemplateSlug, Name: c.ExporterTemplateName}
+}
+
+// OutputData is available to output, along with {{build_name}} and user
+// variables
+type OutputData struct {
+	BuildName string
+	DiskID    string
+	Extension string // e.g. "raw" or "qcow2.gz"
+}
+
+type PostProcessor struct {
+	config Config
+}
+
+func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec {
+	return p.config.FlatMapstructure().HCL2Spec()
+}
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		PluginType:         "hypercloud-export",
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{"output"},
+		},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	var errs *packersdk.MultiError
+
+	// Set defaults
+	if p.config.Output == "" {
+		p.config.Output = DefaultOutput
+	}
+	if p.config.Format == "" {
+		p.config.Format = FormatRaw
+	}
+	if p.config.Compression == "" {
+		p.config.Compression = CompressionNone
+	}
+
+	if p.config.Format != FormatRaw && p.config.Format != FormatQcow2 {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("format must be %s or %s", FormatRaw, FormatQcow2))
+	}
+	switch p.config.Compression {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+	default:
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("compression must be %s, %s or %s", CompressionNone, CompressionGzip, CompressionZstd))
+	}
+
+	if es := p.config.AccessConfig.Prepare(); len(es) > 0 {
+		errs = packersdk.MultiErrorAppend(errs, es...)
+	}
+
+	given := p.config.exporterTemplate().Given()
+	if p.config.ExporterVMID != "" {
+		given += 1
+	}
+	if given != 1 {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("must provide 1 of exporter_vm_id, exporter_template_id, exporter_template_name or exporter_template_slug"))
+	}
+	// A launched exporter needs somewhere to run
+	if p.config.ExporterVMID == "" {
+		if es := p.config.LocationConfig.Prepare(); len(es) > 0 {
+			errs = packersdk.MultiErrorAppend(errs, es...)
+		}
+	}
+	if p.config.SSHUsername == "" {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("ssh_username is required"))
+	}
+	if p.config.SSHPassword == "" && p.config.SSHPrivateKey == "" {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("one of ssh_password or ssh_private_key_file is required"))
+	}
+
+	// Render once with placeholder data to catch syntax errors now
+	if _, err := p.output(OutputData{}); err != nil {
+		errs = packersdk.MultiErrorAppend(errs, err)
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, artifact packersdk.Artifact) (packersdk.Artifact, bool, bool, error) {
+	if !exportableBuilderIDs[artifact.BuilderId()] && artifact.BuilderId() != hccommon.TemplateBuilderID {
+		return nil, false, false, fmt.Errorf(
+			"Unknown artifact type: %s\nCan only export disks built by the hypercloud-clone and hypercloud-vnc builders, or templates published from them.",
+			artifact.BuilderId())
+	}
+	diskID := artifact.Id()
+	if artifact.BuilderId() == hccommon.TemplateBuilderID {
+		var err error
+		if _, diskID, err = hccommon.ArtifactTemplate(artifact); err != nil {
+			return nil, false, false, err
+		}
+	}
+
+	output, err := p.output(OutputData{
+		BuildName: p.config.PackerBuildName,
+		DiskID:    diskID,
+		Extension: p.extension(),
+	})
+	if err != nil {
+		return nil, false, false, err
+	}
+	if _, err := os.Stat(output); err == nil && !p.config.Force {
+		return nil, false, false, fmt.Errorf("Output file %s already exists. Set force to overwrite it.", output)
+	}
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return nil, false, false, fmt.Errorf("Error creating directory for %s: %w", output, err)
+	}
+
+	client := p.config.Client(ui)
+
+	disk, err := api.DiskInfo(client, diskID)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Error getting info for disk %s: %w", diskID, err)
+	}
+	if disk.InstanceID != "" {
+		return nil, false, false, fmt.Errorf("Disk %s is attached to instance %s, it must be unattached to export it", disk.ID, disk.InstanceID)
+	}
+
+	// The raw image is written next to the output, unless it is the output
+	raw := output
+	if p.config.Format != FormatRaw || p.config.Compression != CompressionNone {
+		raw = output + ".tmp.raw"
+		defer os.Remove(raw)
+	}
+
+	// Resources launched for the export are rolled back like a build's
+	state := new(multistep.BasicStateBag)
+	state.Put("client", client)
+	state.Put("ui", ui)
+	exporter, err := p.exporter(ctx, ui, state, disk)
+	defer p.release(ui, state, exporter)
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	rawSum, err := p.download(ctx, ui, client, exporter, disk, raw)
+	if err != nil {
+		os.Remove(raw)
+		return nil, false, false, err
+	}
+
+	sum, err := convert(ui, raw, output, p.config.Format, p.config.Compression)
+	if err != nil {
+		os.Remove(output)
+		return nil, false, false, err
+	}
+	if sum == "" {
+		sum = rawSum
+	}
+	ui.Say(fmt.Sprintf("Exported disk %s to %s (sha256 %s)", disk.ID, output, sum))
+
+	// The disk is still needed in HyperCloud, the file is a copy
+	return &Artifact{
+		path:        output,
+		diskID:      disk.ID,
+		format:      p.config.Format,
+		compression: p.config.Compression,
+		sha256:      sum,
+		rawSHA256:   rawSum,
+	}, true, true, nil
+}
+
+// exporter returns the exporter VM, launching one from the exporter
+// template in the disk's region unless an exporter_vm_id is configured. A
+// launched exporter is returned even on error, for release to destroy.
+func (p *PostProcessor) exporter(ctx context.Context, ui packersdk.Ui, state multistep.StateBag, disk *api.Disk) (*hccommon.HelperInstance, error) {
+	client := state.Get("client").(*api.Client)
+
+	sshConfig, err := hccommon.SSHClientConfig(p.config.SSHUsername, p.config.SSHPassword, p.config.SSHPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if p.config.ExporterVMID != "" {
+		return &hccommon.HelperInstance{ID: p.config.ExporterVMID, SSHConfig: sshConfig}, nil
+	}
+
+	if _, err := p.config.LocationConfig.Resolve(client); err != nil {
+		return nil, err
+	}
+	if p.config.RegionID() != disk.Region.ID {
+		return nil, fmt.Errorf("The exporter VM would be launched in region %s, but disk %s is in region %s", p.config.RegionID(), disk.ID, disk.Region.ID)
+	}
+	exporter, err := hccommon.LaunchHelperInstance(ctx, client, ui, &hccommon.HelperLaunch{
+		Name:           hccommon.BuildResourcePrefix + p.config.PackerBuildName + " exporter",
+		Template:       p.config.exporterTemplate(),
+		Region:         p.config.RegionID(),
+		DiskTierID:     p.config.DiskPerformanceTierID,
+		InstanceTierID: p.config.InstancePerformanceTierID,
+		NetworkID:      p.config.NetworkID,
+		Memory:         512,
+		SSHPassword:    p.config.SSHPassword,
+		SSHPrivateKey:  p.config.SSHPrivateKey,
+		Tags:           api.Tags{hccommon.TagBuildName: p.config.PackerBuildName},
+	}, sshConfig)
+	if err != nil {
+		return exporter, fmt.Errorf("Error launching exporter VM: %w", err)
+	}
+	return exporter, nil
+}
+
+// release destroys an exporter VM launched for the export, or stops a
+// configured one again if the export had to boot it
+func (p *PostProcessor) release(ui packersdk.Ui, state multistep.StateBag, exporter *hccommon.HelperInstance) {
+	if exporter == nil {
+		return
+	}
+	if p.config.ExporterVMID == "" {
+		ui.Say("Terminating the exporter VM")
+		exporter.Destroy(state)
+		hccommon.ReportLeaks(ui, state, p.config.PackerOnError)
+		return
+	}
+	client := state.Get("client").(*api.Client).WithContext(context.Background())
+	if err := exporter.Restore(context.Background(), client, ui); err != nil {
+		ui.Error(err.Error())
+	}
+}
+
+// download streams the disk's contents from the exporter VM into the file
+// at path, and returns their sha256 once it has been checked against the
+// sha256 of the disk calculated on the exporter VM
+func (p *PostProcessor) download(ctx context.Context, ui packersdk.Ui, client *api.Client, exporter *hccommon.HelperInstance, disk *api.Disk, path string) (string, error) {
+	device, err := exporter.Attach(ctx, client, ui, disk.ID)
+	// Always detach, even if attaching failed part way
+	defer func() {
+		ui.Say(fmt.Sprintf("Detaching disk %s from exporter VM", disk.ID))
+		if err := exporter.Detach(context.Background(), client, disk.ID); err != nil && !api.IsNotFound(err) {
+			ui.Error(err.Error())
+		}
+	}()
+	if err != nil {
+		return "", err
+	}
+
+	// No pty, which would mangle binary output
+	comm, err := exporter.Connect(client, false)
+	if err != nil {
+		return "", fmt.Errorf("Connecting to exporter VM failed: %w", err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	ui.Say(fmt.Sprintf("Downloading %d GB disk %s from %s on exporter VM", disk.Size, disk.ID, device))
+	hash := sha256.New()
+	if err := run(ctx, comm, fmt.Sprintf("dd if=%s bs=4M", device), io.MultiWriter(f, hash)); err != nil {
+		return "", fmt.Errorf("Error downloading disk %s: %w", disk.ID, err)
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	local := hex.EncodeToString(hash.Sum(nil))
+
+	ui.Say("Verifying the download")
+	out := new(bytes.Buffer)
+	if err := run(ctx, comm, fmt.Sprintf("sha256sum %s", device), out); err != nil {
+		return "", fmt.Errorf("Error calculating sha256 of disk %s on exporter VM: %w", disk.ID, err)
+	}
+	fields := strings.Fields(out.String())
+	if len(fields) == 0 || fields[0] != local {
+		return "", fmt.Errorf("Checksum of the download does not match disk %s: got sha256 %s, expected %q", disk.ID, local, out.String())
+	}
+	return local, nil
+}
+
+// run runs a command on the exporter VM, writing its stdout to stdout
+func run(ctx context.Context, comm packersdk.Communicator, command string, stdout io.Writer) error {
+	stderr := new(bytes.Buffer)
+	cmd := &packersdk.RemoteCmd{
+		Command: command,
+		Stdout:  stdout,
+		Stderr:  stderr,
+	}
+	if err := comm.Start(ctx, cmd); err != nil {
+		return err
+	}
+	if status := cmd.Wait(); status != 0 {
+		return fmt.Errorf("%q exited with status %d: %s", command, status, stderr.String())
+	}
+	return nil
+}
+
+// extension is the output's file extension, for the format and compression
+func (p *PostProcessor) extension() string {
+	switch p.config.Compression {
+	case CompressionGzip:
+		return p.config.Format + ".gz"
+	case CompressionZstd:
+		return p.config.Format + ".zst"
+	}
+	return p.config.Format
+}
+
+func (p *PostProcessor) output(data OutputData) (string, error) {
+	ctx := p.config.ctx
+	ctx.Data = &data
+	output, err := interpolate.Render(p.config.Output, &ctx)
+	if err != nil {
+		return "", fmt.Errorf("Error rendering output: %w", err)
+	}
+	return output, nil
+}
@@ -0,0 +1,17 @@
+package export
+
+import (
+	"context"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	hccommon "github.com/thehypercloud/packer-hypercloud/builder/hypercloud/common"
+)
+
+func TestPostProcessTemplateWithoutState(t *testing.T) {
+	artifact := &packersdk.MockArtifact{BuilderIdValue: hccommon.TemplateBuilderID, IdValue: "t1"}
+	_, _, _, err := new(PostProcessor).PostProcess(context.Background(), packersdk.TestUi(t), artifact)
+	if err == nil {
+		t.Fatal("expected an error for a template artifact without its state")
+	}
+}
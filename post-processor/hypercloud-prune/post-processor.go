@@ -0,0 +1,217 @@
+// Package prune contains a post-processor that deletes the disks or
+// templates left by earlier runs of a build, keeping the newest.
+package prune
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/thehypercloud/packer-hypercloud/api"
+	hccommon "github.com/thehypercloud/packer-hypercloud/builder/hypercloud/common"
+)
+
+var diskBuilderIDs = map[string]bool{
+	hccommon.CloneBuilderID: true,
+	hccommon.VNCBuilderID:   true,
+}
+
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+
+type Config struct {
+	common.PackerConfig   `mapstructure:",squash"`
+	hccommon.AccessConfig `mapstructure:",squash"`
+
+	KeepNewest       int    `mapstructure:"keep_newest"`
+	RawKeepNewerThan string `mapstructure:"keep_newer_than"`
+	DryRun           bool   `mapstructure:"dry_run"`
+
+	keepNewerThan time.Duration
+
+	ctx interpolate.Context
+}
+
+type PostProcessor struct {
+	config Config
+}
+
+func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec {
+	return p.config.FlatMapstructure().HCL2Spec()
+}
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		PluginType:         "hypercloud-prune",
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	var errs *packersdk.MultiError
+
+	if es := p.config.AccessConfig.Prepare(); len(es) > 0 {
+		errs = packersdk.MultiErrorAppend(errs, es...)
+	}
+
+	if p.config.KeepNewest < 0 {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("keep_newest must not be negative"))
+	}
+	if p.config.RawKeepNewerThan != "" {
+		if keep, err := time.ParseDuration(p.config.RawKeepNewerThan); err != nil {
+			errs = packersdk.MultiErrorAppend(
+				errs, fmt.Errorf("Failed parsing keep_newer_than: %s", err))
+		} else if keep <= 0 {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("keep_newer_than must be positive"))
+		} else {
+			p.config.keepNewerThan = keep
+		}
+	}
+	if p.config.KeepNewest == 0 && p.config.RawKeepNewerThan == "" {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("at least one of keep_newest or keep_newer_than is required"))
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// PostProcess prunes the earlier artifacts of the build, and passes the
+// artifact through unchanged
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, artifact packersdk.Artifact) (packersdk.Artifact, bool, bool, error) {
+	id := artifact.BuilderId()
+	if !diskBuilderIDs[id] && id != hccommon.TemplateBuilderID {
+		return nil, false, false, fmt.Errorf(
+			"Unknown artifact type: %s\nCan only prune disks built by the hypercloud-clone and hypercloud-vnc builders, or templates published from them.",
+			id)
+	}
+	var template *api.Template
+	if id == hccommon.TemplateBuilderID {
+		var err error
+		if template, _, err = hccommon.ArtifactTemplate(artifact); err != nil {
+			return nil, false, false, err
+		}
+	}
+
+	client := p.config.Client(ui)
+	keep := retention{
+		keepNewest:    p.config.KeepNewest,
+		keepNewerThan: p.config.keepNewerThan,
+		now:           time.Now(),
+	}
+
+	disks, err := api.DiskList(client)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Error listing disks: %w", err)
+	}
+	templates, err := api.ListTemplates(client)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Error listing templates: %w", err)
+	}
+
+	var failed []string
+	if template != nil {
+		failed = p.pruneTemplates(ui, client, keep, templates, disks, template)
+	} else {
+		failed = p.pruneDisks(ui, client, keep, templates, disks, artifact)
+	}
+	if len(failed) > 0 {
+		return nil, false, false, fmt.Errorf("Error pruning earlier artifacts:\n%s", strings.Join(failed, "\n"))
+	}
+	return artifact, true, true, nil
+}
+
+func (p *PostProcessor) pruneDisks(ui packersdk.Ui, client *api.Client, keep retention, templates []api.Template, disks []api.Disk, artifact packersdk.Artifact) (failed []string) {
+	buildName := p.config.PackerBuildName
+	if tags, ok := artifact.State("tags").(map[string]string); ok && tags[hccommon.TagBuildName] != "" {
+		buildName = tags[hccommon.TagBuildName]
+	}
+	region, _ := artifact.State("region").(string)
+
+	earlier := earlierDisks(disks, templates, buildName, region, artifact.Id())
+	created := make([]time.Time, len(earlier))
+	for i := range earlier {
+		created[i] = earlier[i].CreatedAt.Time
+	}
+	prune := keep.prunable(created)
+	ui.Say(fmt.Sprintf("Found %d earlier disks from build %s, pruning %d", len(earlier), buildName, len(prune)))
+
+	for _, i := range prune {
+		if err := p.deleteDisk(ui, client, &earlier[i]); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	return failed
+}
+
+func (p *PostProcessor) pruneTemplates(ui packersdk.Ui, client *api.Client, keep retention, templates []api.Template, disks []api.Disk, template *api.Template) (failed []string) {
+	label := template.Slug
+	if label == "" {
+		label = template.Name
+	}
+
+	earlier := earlierTemplates(templates, template)
+	created := make([]time.Time, len(earlier))
+	for i := range earlier {
+		created[i] = earlier[i].CreatedAt.Time
+	}
+	prune := keep.prunable(created)
+	ui.Say(fmt.Sprintf("Found %d earlier versions of template %s, pruning %d", len(earlier), label, len(prune)))
+
+	for _, i := range prune {
+		t := &earlier[i]
+		// Check the disks before deleting anything, so that a template is
+		// never left without its disk
+		published := publishedDisks(disks, t)
+		attached := false
+		for j := range published {
+			if published[j].InstanceID != "" {
+				ui.Message(fmt.Sprintf("Not pruning template %s version %d: its disk %s is attached to instance %s",
+					t.ID, t.Version, published[j].ID, published[j].InstanceID))
+				attached = true
+			}
+		}
+		if attached {
+			continue
+		}
+
+		ui.Message(fmt.Sprintf("Pruning template %s version %d (%s)", t.ID, t.Version, t.Name))
+		if p.config.DryRun {
+			continue
+		}
+		if err := api.TemplateDelete(client, t.ID); err != nil && !api.IsNotFound(err) {
+			failed = append(failed, fmt.Sprintf("template %s: %s", t.ID, err))
+			continue
+		}
+		for j := range published {
+			if err := p.deleteDisk(ui, client, &published[j]); err != nil {
+				failed = append(failed, err.Error())
+			}
+		}
+	}
+	return failed
+}
+
+// deleteDisk deletes a disk, unless it is attached to an instance
+func (p *PostProcessor) deleteDisk(ui packersdk.Ui, client *api.Client, disk *api.Disk) error {
+	if disk.InstanceID != "" {
+		ui.Message(fmt.Sprintf("Not pruning disk %s (%s): it is attached to instance %s", disk.ID, disk.Name, disk.InstanceID))
+		return nil
+	}
+	ui.Message(fmt.Sprintf("Pruning disk %s (%s)", disk.ID, disk.Name))
+	if p.config.DryRun {
+		return nil
+	}
+	if err := api.DiskDelete(client, disk.ID); err != nil && !api.IsNotFound(err) {
+		return fmt.Errorf("disk %s: %w", disk.ID, err)
+	}
+	return nil
+}
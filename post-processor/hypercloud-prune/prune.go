@@ -0,0 +1,107 @@
+package prune
+
+import (
+	"sort"
+	"time"
+
+	"github.com/thehypercloud/packer-hypercloud/api"
+	hccommon "github.com/thehypercloud/packer-hypercloud/builder/hypercloud/common"
+)
+
+// retention decides which of a build's earlier artifacts are kept. An
+// artifact is kept if it is one of the newest, or newer than the cut off.
+type retention struct {
+	keepNewest    int           // zero keeps none by count
+	keepNewerThan time.Duration // zero keeps none by age
+	now           time.Time
+}
+
+// prunable returns the indexes of the artifacts that aren't kept, given
+// the creation times of the earlier artifacts sorted newest first. The
+// artifact just built counts towards keepNewest. Artifacts whose creation
+// time is unknown are never pruned by age.
+func (r retention) prunable(created []time.Time) []int {
+	var prune []int
+	for i, t := range created {
+		if r.keepNewest > 0 && i < r.keepNewest-1 {
+			continue
+		}
+		if r.keepNewerThan > 0 && (t.IsZero() || r.now.Sub(t) < r.keepNewerThan) {
+			continue
+		}
+		prune = append(prune, i)
+	}
+	return prune
+}
+
+// earlierDisks returns the finished disks of earlier runs of the build in
+// region, newest first. Disks are recognised by their tags, so disks from
+// before tagging was added, and disks still being built, are never pruned.
+// Disks that have been published as a template are left to be pruned with
+// the template.
+func earlierDisks(disks []api.Disk, templates []api.Template, buildName string, region string, exclude string) []api.Disk {
+	published := make(map[string]bool)
+	for _, t := range templates {
+		if uuid := t.Tags[hccommon.TagBuildUUID]; uuid != "" {
+			published[uuid] = true
+		}
+	}
+	var found []api.Disk
+	for _, disk := range disks {
+		if disk.ID == exclude || disk.Region.ID != region || published[disk.Tags[hccommon.TagBuildUUID]] {
+			continue
+		}
+		if disk.Tags[hccommon.TagArtifact] != "true" || disk.Tags[hccommon.TagBuildName] != buildName {
+			continue
+		}
+		found = append(found, disk)
+	}
+	sort.Stable(byCreatedDesc(found))
+	return found
+}
+
+// byCreatedDesc sorts disks newest first
+type byCreatedDesc []api.Disk
+
+func (s byCreatedDesc) Len() int {
+	return len(s)
+}
+func (s byCreatedDesc) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s byCreatedDesc) Less(i, j int) bool {
+	return s[i].CreatedAt.After(s[j].CreatedAt.Time)
+}
+
+// earlierTemplates returns the earlier versions of a template in region,
+// newest first. Versions are matched by slug, or by name if the template
+// has no slug, as when publishing.
+func earlierTemplates(templates []api.Template, template *api.Template) []api.Template {
+	var found []api.Template
+	for _, t := range templates {
+		if t.ID == template.ID || t.Region.ID != template.Region.ID {
+			continue
+		}
+		if (template.Slug != "" && t.Slug == template.Slug) || (template.Slug == "" && t.Name == template.Name) {
+			found = append(found, t)
+		}
+	}
+	sort.Stable(api.ByVersionDesc(found))
+	return found
+}
+
+// publishedDisks returns the disks that were published as the template,
+// recognised by being the finished disk of the same run of the build
+func publishedDisks(disks []api.Disk, template *api.Template) []api.Disk {
+	uuid := template.Tags[hccommon.TagBuildUUID]
+	if uuid == "" {
+		return nil
+	}
+	var found []api.Disk
+	for _, disk := range disks {
+		if disk.Tags[hccommon.TagArtifact] == "true" && disk.Tags[hccommon.TagBuildUUID] == uuid {
+			found = append(found, disk)
+		}
+	}
+	return found
+}
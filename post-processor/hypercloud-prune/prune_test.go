@@ -0,0 +1,112 @@
+package prune
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/thehypercloud/packer-hypercloud/api"
+	hccommon "github.com/thehypercloud/packer-hypercloud/builder/hypercloud/common"
+)
+
+func TestRetentionPrunable(t *testing.T) {
+	now := time.Date(2020, 1, 10, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	// Earlier artifacts, newest first: 1, 2, 3 and 5 days old, then unknown
+	created := []time.Time{now.Add(-day), now.Add(-2 * day), now.Add(-3 * day), now.Add(-5 * day), {}}
+
+	for _, tc := range []struct {
+		name string
+		r    retention
+		want []int
+	}{
+		{"keep nothing", retention{now: now}, []int{0, 1, 2, 3, 4}},
+		{"keep newest 1 is just the new one", retention{keepNewest: 1, now: now}, []int{0, 1, 2, 3, 4}},
+		{"keep newest 3", retention{keepNewest: 3, now: now}, []int{2, 3, 4}},
+		{"keep more than there are", retention{keepNewest: 10, now: now}, nil},
+		{"keep newer than", retention{keepNewerThan: 2*day + time.Hour, now: now}, []int{2, 3}},
+		{"either keeps", retention{keepNewest: 4, keepNewerThan: 2*day + time.Hour, now: now}, []int{3}},
+		{"exactly the cut off is pruned", retention{keepNewerThan: 3 * day, now: now}, []int{2, 3}},
+	} {
+		if got := tc.r.prunable(created); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: prunable = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestEarlierDisks(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	artifact := func(id string, build string, uuid string, region string, created time.Time) api.Disk {
+		return api.Disk{
+			ID:        id,
+			Region:    api.Region{ID: region},
+			CreatedAt: api.Timestamp{Time: created},
+			Tags: api.Tags{
+				hccommon.TagArtifact:  "true",
+				hccommon.TagBuildName: build,
+				hccommon.TagBuildUUID: uuid,
+			},
+		}
+	}
+	disks := []api.Disk{
+		artifact("old", "web", "u1", "r1", t0),
+		artifact("new", "web", "u2", "r1", t0.Add(2*time.Hour)),
+		artifact("mid", "web", "u3", "r1", t0.Add(time.Hour)),
+		artifact("current", "web", "u4", "r1", t0.Add(3*time.Hour)),
+		artifact("published", "web", "u5", "r1", t0),
+		artifact("other build", "db", "u6", "r1", t0),
+		artifact("other region", "web", "u7", "r2", t0),
+		{ID: "untagged", Region: api.Region{ID: "r1"}},
+		{ID: "in progress", Region: api.Region{ID: "r1"}, Tags: api.Tags{hccommon.TagBuildName: "web"}},
+	}
+	templates := []api.Template{{ID: "t", Tags: api.Tags{hccommon.TagBuildUUID: "u5"}}}
+
+	got := earlierDisks(disks, templates, "web", "r1", "current")
+	var ids []string
+	for _, disk := range got {
+		ids = append(ids, disk.ID)
+	}
+	if want := []string{"new", "mid", "old"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("earlierDisks = %v, want %v", ids, want)
+	}
+}
+
+func TestEarlierTemplates(t *testing.T) {
+	r1, r2 := api.Region{ID: "r1"}, api.Region{ID: "r2"}
+	templates := []api.Template{
+		{ID: "1", Name: "web", Slug: "web", Version: 1, Region: r1},
+		{ID: "3", Name: "web", Slug: "web", Version: 3, Region: r1},
+		{ID: "2", Name: "renamed", Slug: "web", Version: 2, Region: r1},
+		{ID: "4", Name: "web", Slug: "web", Version: 4, Region: r1},
+		{ID: "5", Name: "web", Slug: "web", Version: 1, Region: r2},
+		{ID: "6", Name: "web", Slug: "other", Version: 1, Region: r1},
+		{ID: "7", Name: "unslugged", Version: 1, Region: r1},
+		{ID: "8", Name: "unslugged", Version: 2, Region: r1},
+	}
+	for _, tc := range []struct {
+		template api.Template
+		want     []string
+	}{
+		{templates[3], []string{"3", "2", "1"}},
+		{templates[7], []string{"7"}},
+		{api.Template{ID: "9", Slug: "none", Region: r1}, nil},
+	} {
+		var ids []string
+		for _, t := range earlierTemplates(templates, &tc.template) {
+			ids = append(ids, t.ID)
+		}
+		if !reflect.DeepEqual(ids, tc.want) {
+			t.Errorf("earlierTemplates(%s) = %v, want %v", tc.template.ID, ids, tc.want)
+		}
+	}
+}
+
+func TestPostProcessTemplateWithoutState(t *testing.T) {
+	artifact := &packersdk.MockArtifact{BuilderIdValue: hccommon.TemplateBuilderID, IdValue: "t1"}
+	_, _, _, err := new(PostProcessor).PostProcess(context.Background(), packersdk.TestUi(t), artifact)
+	if err == nil {
+		t.Fatal("expected an error for a template artifact without its state")
+	}
+}
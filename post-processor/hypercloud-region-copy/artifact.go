@@ -0,0 +1,118 @@
+package regioncopy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/thehypercloud/packer-hypercloud/api"
+)
+
+const (
+	builderID = "hypercloud.region-copy"
+)
+
+// RegionCopy is the disk, and the template published from it if the
+// source was a template, in one region
+type RegionCopy struct {
+	Region   api.Region
+	Disk     *api.Disk
+	Template *api.Template
+}
+
+// id is the template's id if there is one, or the disk's
+func (c *RegionCopy) id() string {
+	if c.Template != nil {
+		return c.Template.ID
+	}
+	return c.Disk.ID
+}
+
+func (c *RegionCopy) destroy(client *api.Client) error {
+	if c.Template != nil {
+		if err := api.TemplateDelete(client, c.Template.ID); err != nil && !api.IsNotFound(err) {
+			return err
+		}
+	}
+	if err := api.DiskDelete(client, c.Disk.ID); err != nil && !api.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// Artifact is the source disk or template and its copies, the source first
+type Artifact struct {
+	Copies []RegionCopy
+	client *api.Client
+}
+
+func (*Artifact) BuilderId() string {
+	return builderID
+}
+
+func (a *Artifact) Files() []string {
+	return make([]string, 0) // empty slice - no files generated
+}
+
+// Id is a comma separated list of region:id, like Packer's multi-region
+// Amazon artifacts
+func (a *Artifact) Id() string {
+	parts := make([]string, 0, len(a.Copies))
+	for _, c := range a.Copies {
+		parts = append(parts, fmt.Sprintf("%s:%s", c.Region.ID, c.id()))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func (a *Artifact) String() string {
+	lines := make([]string, 0, len(a.Copies))
+	for _, c := range a.Copies {
+		if c.Template != nil {
+			lines = append(lines, fmt.Sprintf("%s: Template: %s (disk %s)", c.Region.ID, c.Template.ID, c.Disk.ID))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s: Disk: %s : %s", c.Region.ID, c.Disk.ID, c.Disk.Name))
+		}
+	}
+	return fmt.Sprintf("Copies in %d regions:\n%s", len(a.Copies), strings.Join(lines, "\n"))
+}
+
+func (a *Artifact) State(name string) interface{} {
+	switch name {
+	case "regions":
+		regions := make([]string, len(a.Copies))
+		for i, c := range a.Copies {
+			regions[i] = c.Region.ID
+		}
+		return regions
+	case "disks":
+		disks := make(map[string]string, len(a.Copies))
+		for _, c := range a.Copies {
+			disks[c.Region.ID] = c.Disk.ID
+		}
+		return disks
+	case "templates":
+		templates := make(map[string]string, len(a.Copies))
+		for _, c := range a.Copies {
+			if c.Template != nil {
+				templates[c.Region.ID] = c.Template.ID
+			}
+		}
+		return templates
+	}
+	return nil
+}
+
+// Destroy deletes the copies in every region, including the source
+func (a *Artifact) Destroy() error {
+	var failed []string
+	for _, c := range a.Copies {
+		if err := c.destroy(a.client); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", c.Region.ID, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("Error deleting copies in %d regions:\n%s", len(failed), strings.Join(failed, "\n"))
+	}
+	return nil
+}
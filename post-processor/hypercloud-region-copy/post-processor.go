@@ -0,0 +1,182 @@
+// Package regioncopy contains a post-processor that copies a disk built by
+// the HyperCloud builders, or the template published from it, into other
+// regions.
+package regioncopy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/thehypercloud/packer-hypercloud/api"
+	hccommon "github.com/thehypercloud/packer-hypercloud/builder/hypercloud/common"
+)
+
+// Artifacts that can be copied. Templates are copied by copying the disk
+// they were published from and publishing the copy in each region.
+var copyableBuilderIDs = map[string]bool{
+	hccommon.CloneBuilderID:    true,
+	hccommon.VNCBuilderID:      true,
+	hccommon.TemplateBuilderID: true,
+}
+
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+
+type Config struct {
+	common.PackerConfig   `mapstructure:",squash"`
+	hccommon.AccessConfig `mapstructure:",squash"`
+
+	DiskPerformanceTierIDs []string `mapstructure:"disk_performance_tier_ids"`
+
+	ctx interpolate.Context
+}
+
+type PostProcessor struct {
+	config Config
+}
+
+func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec {
+	return p.config.FlatMapstructure().HCL2Spec()
+}
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		PluginType:         "hypercloud-region-copy",
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	var errs *packersdk.MultiError
+
+	if es := p.config.AccessConfig.Prepare(); len(es) > 0 {
+		errs = packersdk.MultiErrorAppend(errs, es...)
+	}
+
+	if len(p.config.DiskPerformanceTierIDs) == 0 {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("disk_performance_tier_ids must list at least one tier to copy to"))
+	}
+	seen := make(map[string]bool)
+	for _, id := range p.config.DiskPerformanceTierIDs {
+		if id == "" {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("disk_performance_tier_ids must not contain an empty id"))
+		} else if seen[id] {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("disk performance tier %s is listed more than once", id))
+		}
+		seen[id] = true
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, artifact packersdk.Artifact) (packersdk.Artifact, bool, bool, error) {
+	if !copyableBuilderIDs[artifact.BuilderId()] {
+		return nil, false, false, fmt.Errorf(
+			"Unknown artifact type: %s\nCan only copy disks built by the hypercloud-clone and hypercloud-vnc builders, or templates published from them.",
+			artifact.BuilderId())
+	}
+
+	client := p.config.Client(ui)
+
+	diskID := artifact.Id()
+	var template *api.Template
+	if artifact.BuilderId() == hccommon.TemplateBuilderID {
+		var err error
+		template, diskID, err = hccommon.ArtifactTemplate(artifact)
+		if err != nil {
+			return nil, false, false, err
+		}
+	}
+	source, err := api.DiskInfo(client, diskID)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Error getting info for disk %s: %w", diskID, err)
+	}
+
+	// Look up every tier before copying anything, so that a typo doesn't
+	// leave copies in some regions and not others
+	tiers := make([]*api.PerformanceTier, 0, len(p.config.DiskPerformanceTierIDs))
+	regions := map[string]bool{source.Region.ID: true}
+	for _, id := range p.config.DiskPerformanceTierIDs {
+		tier, err := api.FindDiskTier(client, id)
+		if err != nil {
+			return nil, false, false, err
+		}
+		if tier.Region.ID == source.Region.ID {
+			return nil, false, false, fmt.Errorf("Disk performance tier %s is in region %s, which the disk is already in", tier.ID, source.Region.ID)
+		}
+		if regions[tier.Region.ID] {
+			return nil, false, false, fmt.Errorf("More than one disk performance tier is in region %s", tier.Region.ID)
+		}
+		regions[tier.Region.ID] = true
+		tiers = append(tiers, tier)
+	}
+
+	result := &Artifact{
+		Copies: []RegionCopy{{Region: source.Region, Disk: source, Template: template}},
+		client: client,
+	}
+	for _, tier := range tiers {
+		copied, err := p.copyTo(ctx, ui, client, source, template, tier)
+		if copied.Disk != nil {
+			result.Copies = append(result.Copies, copied)
+		}
+		if err != nil {
+			ui.Error(err.Error())
+			deleteCopies(ui, client, result.Copies[1:])
+			return nil, false, false, err
+		}
+	}
+
+	// The source is part of the new artifact, so it must be kept
+	return result, true, true, nil
+}
+
+// copyTo copies the source disk, and publishes the copy if the source was
+// a template. If it fails part way, the copy is returned along with the
+// error so that it can be deleted.
+func (p *PostProcessor) copyTo(ctx context.Context, ui packersdk.Ui, client *api.Client, source *api.Disk, template *api.Template, tier *api.PerformanceTier) (RegionCopy, error) {
+	copied := RegionCopy{Region: tier.Region}
+
+	ui.Say(fmt.Sprintf("Copying disk %s to region %s", source.ID, tier.Region.Name))
+	disk, err := api.CopyDisk(ctx, client, source.ID, source.Name, tier.Region.ID, tier.ID, source.Tags)
+	copied.Disk = disk
+	if err != nil {
+		return copied, fmt.Errorf("Error copying disk %s to region %s: %w", source.ID, tier.Region.ID, err)
+	}
+	disk, err = api.UpdateDisk(client, disk.ID, map[string]interface{}{"description": source.Description})
+	if err != nil {
+		return copied, fmt.Errorf("Error setting description of disk %s: %w", copied.Disk.ID, err)
+	}
+	copied.Disk = disk
+	ui.Message(fmt.Sprintf("Copied to disk %s", disk.ID))
+
+	if template == nil {
+		return copied, nil
+	}
+	ui.Say(fmt.Sprintf("Publishing disk %s as template %s in region %s", disk.ID, template.Name, tier.Region.Name))
+	copied.Template, err = api.TemplateCreate(client, disk.ID, tier.Region.ID, template.Name, template.Slug, template.Tags)
+	if err != nil {
+		return copied, fmt.Errorf("Error publishing template in region %s: %w", tier.Region.ID, err)
+	}
+	ui.Message(fmt.Sprintf("Published template %s version %d", copied.Template.ID, copied.Template.Version))
+	return copied, nil
+}
+
+// deleteCopies deletes the copies made before a copy failed
+func deleteCopies(ui packersdk.Ui, client *api.Client, copies []RegionCopy) {
+	for _, c := range copies {
+		ui.Say(fmt.Sprintf("Deleting the copy in region %s", c.Region.ID))
+		if err := c.destroy(client); err != nil {
+			ui.Error(fmt.Sprintf("Error deleting the copy in region %s, it must be deleted manually: %s", c.Region.ID, err))
+		}
+	}
+}
@@ -0,0 +1,20 @@
+// Package version is the version of the plugin, which Packer reads with
+// the plugin's describe command
+package version
+
+import "github.com/hashicorp/packer-plugin-sdk/version"
+
+var (
+	// Version is the released version, without a leading "v"
+	Version = "0.1.0"
+
+	// VersionPrerelease marks a build that isn't a release, such as "dev".
+	// Releases set it to "" with -ldflags.
+	VersionPrerelease = "dev"
+
+	// VersionMetadata is optional build metadata, such as a commit
+	VersionMetadata = ""
+
+	// PluginVersion is given to the plugin set
+	PluginVersion = version.NewPluginVersion(Version, VersionPrerelease, VersionMetadata)
+)